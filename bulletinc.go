@@ -0,0 +1,122 @@
+package webntp
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var (
+	// e.g. "Paris, 6 July 2016"
+	bulletinCDate = regexp.MustCompile(`Paris,\s+(\d{1,2})\s+([A-Za-z]+)\s+(\d{4})`)
+
+	// e.g. "A positive leap second will be introduced at the end of December 2016."
+	// e.g. "NO leap second will be introduced at the end of June 2019."
+	bulletinCEnd = regexp.MustCompile(`introduced\s+at\s+the\s+end\s+of\s+([A-Za-z]+)\s+(\d{4})`)
+
+	// e.g. "from 2017 January 1, 0h UTC, until further notice : UTC-TAI = -37 s"
+	bulletinCOffset = regexp.MustCompile(`from\s+(\d{4})\s+([A-Za-z]+)\s+(\d{1,2}),?\s+0h\s+UTC[^:]*:\s*UTC-TAI\s*=\s*-\s*(\d+)\s*s`)
+)
+
+// ParseBulletinC parses IERS Bulletin C, which announces leap seconds.
+//
+// The leap seconds are taken from the "UTC-TAI = - N s" lines,
+// and the earlier ones from the embedded list (DefaultLeapSecondsList),
+// because a bulletin has only the latest values of UTC - TAI.
+// If the bulletin has only one such line, TAI - UTC before it is also taken from the embedded list.
+// The update date is the date of the bulletin, and the expiration date is the 28th of
+// the sixth month after the leap second opportunity that the bulletin announces,
+// as leap-seconds.list does.
+// It returns *LeapSecondsParseError if the bulletin is malformed.
+func ParseBulletinC(r io.Reader) (*LeapSecondsList, error) {
+	data, err := readLeapSeconds(r)
+	if err != nil {
+		return nil, err
+	}
+
+	m := bulletinCDate.FindSubmatch(data)
+	if m == nil {
+		return nil, &LeapSecondsParseError{Err: ErrLeapSecondsListNoUpdate, Detail: "missing the date of the bulletin"}
+	}
+	updateAt, err := parseBulletinCDate(string(m[3]), string(m[2]), string(m[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	m = bulletinCEnd.FindSubmatch(data)
+	if m == nil {
+		return nil, &LeapSecondsParseError{Err: ErrLeapSecondsListNoExpire, Detail: "missing the leap second opportunity"}
+	}
+	end, err := parseBulletinCDate(string(m[2]), string(m[1]), "1")
+	if err != nil {
+		return nil, err
+	}
+	expireAt := time.Date(end.Year(), end.Month()+6, 28, 0, 0, 0, 0, time.UTC)
+
+	offsets := bulletinCOffset.FindAllSubmatch(data, -1)
+	if len(offsets) == 0 {
+		return nil, &LeapSecondsParseError{Err: ErrLeapSecondsListEmpty}
+	}
+	type offset struct {
+		at   time.Time
+		leap int
+	}
+	list := make([]offset, 0, len(offsets))
+	for _, m := range offsets {
+		at, err := parseBulletinCDate(string(m[1]), string(m[2]), string(m[3]))
+		if err != nil {
+			return nil, err
+		}
+		leap, err := strconv.Atoi(string(m[4]))
+		if err != nil {
+			return nil, &LeapSecondsParseError{Err: ErrLeapSecondsListSyntax, Detail: fmt.Sprintf("invalid UTC-TAI %q", truncate(string(m[4]), 32))}
+		}
+		list = append(list, offset{at: at, leap: leap})
+	}
+	history := DefaultLeapSecondsList()
+	if len(list) == 1 {
+		list = append([]offset{{leap: history.TAIMinusUTC(list[0].at.Add(-time.Second))}}, list...)
+	}
+
+	leaps := make([]LeapSecond, 0, len(list)-1)
+	for i := 1; i < len(list); i++ {
+		if !list[i-1].at.Before(list[i].at) {
+			return nil, &LeapSecondsParseError{Err: ErrLeapSecondsListNotSorted, Detail: fmt.Sprintf("%s follows %s", list[i].at.Format(time.DateOnly), list[i-1].at.Format(time.DateOnly))}
+		}
+		step := list[i].leap - list[i-1].leap
+		if step != 1 && step != -1 {
+			return nil, &LeapSecondsParseError{Err: ErrLeapSecondsListInvalidStep, Detail: fmt.Sprintf("from %d to %d", list[i-1].leap, list[i].leap)}
+		}
+		leaps = append(leaps, LeapSecond{
+			At:   list[i].at,
+			Leap: list[i-1].leap,
+			Step: step,
+		})
+	}
+
+	// the leap seconds before the bulletin.
+	var n int
+	for n < len(history.LeapSeconds) && history.LeapSeconds[n].At.Before(leaps[0].At) {
+		n++
+	}
+	if n > 0 && history.TAIMinusUTC(leaps[0].At.Add(-time.Second)) != leaps[0].Leap {
+		return nil, &LeapSecondsParseError{Err: ErrLeapSecondsListInvalidStep, Detail: fmt.Sprintf("UTC-TAI = -%d s contradicts the embedded list", leaps[0].Leap)}
+	}
+	leaps = append(history.LeapSeconds[:n:n], leaps...)
+
+	return &LeapSecondsList{
+		LeapSeconds: leaps,
+		UpdateAt:    updateAt,
+		ExpireAt:    expireAt,
+	}, nil
+}
+
+func parseBulletinCDate(year, month, day string) (time.Time, error) {
+	t, err := time.Parse("2006 January 2", year+" "+month+" "+day)
+	if err != nil {
+		return time.Time{}, &LeapSecondsParseError{Err: ErrLeapSecondsListSyntax, Detail: fmt.Sprintf("invalid date %q", truncate(year+" "+month+" "+day, 32))}
+	}
+	return t, nil
+}
@@ -0,0 +1,154 @@
+package webntp
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseBulletinC(t *testing.T) {
+	// the bulletins have only the last leap second, and the others are taken from the embedded list.
+	history := DefaultLeapSecondsList().LeapSeconds
+	tests := []struct {
+		name string
+		want *LeapSecondsList
+	}{
+		{
+			// announces the leap second.
+			name: "testdata/bulletinc-52.txt",
+			want: &LeapSecondsList{
+				LeapSeconds: history,
+				UpdateAt:    time.Date(2016, time.July, 6, 0, 0, 0, 0, time.UTC),
+				ExpireAt:    time.Date(2017, time.June, 28, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			// no leap second.
+			name: "testdata/bulletinc-57.txt",
+			want: &LeapSecondsList{
+				LeapSeconds: history,
+				UpdateAt:    time.Date(2019, time.January, 7, 0, 0, 0, 0, time.UTC),
+				ExpireAt:    time.Date(2019, time.December, 28, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := os.Open(tc.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			got, err := ParseBulletinC(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseBulletinC_Errors(t *testing.T) {
+	const header = "Paris, 6 July 2016\nBulletin C 52\n" +
+		"A negative leap second will be introduced at the end of December 2016.\n"
+	tests := map[string]struct {
+		input string
+		want  error
+	}{
+		"no date": {
+			"Bulletin C 52\nNO leap second will be introduced at the end of June 2019.\n" +
+				"from 2017 January 1, 0h UTC, until further notice : UTC-TAI = -37 s\n",
+			ErrLeapSecondsListNoUpdate,
+		},
+		"no opportunity": {
+			"Paris, 6 July 2016\nBulletin C 52\n" +
+				"from 2017 January 1, 0h UTC, until further notice : UTC-TAI = -37 s\n",
+			ErrLeapSecondsListNoExpire,
+		},
+		"no offset": {header, ErrLeapSecondsListEmpty},
+		"bad month": {
+			header + "from 2017 Foo 1, 0h UTC, until further notice : UTC-TAI = -37 s\n",
+			ErrLeapSecondsListSyntax,
+		},
+		"not sorted": {
+			header +
+				"from 2017 January 1, 0h UTC, to 2015 July 1 0h UTC : UTC-TAI = - 36s\n" +
+				"from 2015 July 1, 0h UTC, until further notice : UTC-TAI = - 37s\n",
+			ErrLeapSecondsListNotSorted,
+		},
+		"contradicts the history": {
+			header +
+				"from 2015 July 1, 0h UTC, to 2017 January 1 0h UTC : UTC-TAI = - 35s\n" +
+				"from 2017 January 1, 0h UTC, until further notice : UTC-TAI = - 36s\n",
+			ErrLeapSecondsListInvalidStep,
+		},
+		"invalid step": {
+			header +
+				"from 2015 July 1, 0h UTC, to 2017 January 1 0h UTC : UTC-TAI = - 35s\n" +
+				"from 2017 January 1, 0h UTC, until further notice : UTC-TAI = - 37s\n",
+			ErrLeapSecondsListInvalidStep,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseBulletinC(strings.NewReader(tc.input))
+			var perr *LeapSecondsParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("want LeapSecondsParseError, got %v", err)
+			}
+			if !errors.Is(err, tc.want) {
+				t.Errorf("want %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestParseBulletinC_WriteTo(t *testing.T) {
+	f, err := os.Open("testdata/bulletinc-57.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	list, err := ParseBulletinC(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		utc  time.Time
+		want int
+	}{
+		{time.Date(1972, time.January, 1, 0, 0, 0, 0, time.UTC), 10},
+		{time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC), 32},
+		{time.Date(2016, time.December, 31, 0, 0, 0, 0, time.UTC), 36},
+		{time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC), 37},
+	}
+	for _, tc := range tests {
+		if got := list.TAIMinusUTC(tc.utc); got != tc.want {
+			t.Errorf("TAIMinusUTC(%s): want %d, got %d", tc.utc.Format(time.DateOnly), tc.want, got)
+		}
+	}
+
+	var buf strings.Builder
+	if _, err := list.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"2272060800\t10\t# 1 Jan 1972\n", "3692217600\t37\t# 1 Jan 2017\n"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("want %q in:\n%s", line, buf.String())
+		}
+	}
+	got, err := ParseLeapSecondsList(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(list, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -2,14 +2,17 @@ package webntp
 
 import (
 	"context"
+	"crypto/ed25519"
 	crand "crypto/rand"
 	"encoding/binary"
 	"encoding/json"
+	"log/slog"
 	"math/bits"
 	"math/rand"
 	"net/http"
 	"net/http/httptrace"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -25,12 +28,30 @@ var clientEndTime = time.Now
 type Client struct {
 	HTTPClient *http.Client
 	Dialer     *websocket.Dialer
+
+	// NTPOverHTTP makes the client use NTP over HTTP for http and https URLs.
+	// The URLs with ntp+http and ntp+https schemes always use NTP over HTTP.
+	NTPOverHTTP bool
+
+	// TrustedKeys is the Ed25519 public keys of trusted servers.
+	// If not empty, the client sends a random nonce with JSON requests,
+	// and rejects the responses that are not signed by any of the keys.
+	// The protocols that cannot be signed (NTP over UDP, HTTP and WebSocket) are refused.
+	TrustedKeys []ed25519.PublicKey
+
+	// RoughtimeKeys is the long-term public keys of Roughtime servers, keyed by host.
+	// The "pubkey" query parameter of roughtime URLs, encoded in base64, takes precedence.
+	RoughtimeKeys map[string]ed25519.PublicKey
+
+	// Logger is the logger of the client.
+	// If nil, slog.Default() is used.
+	Logger *slog.Logger
 }
 
 // DefaultDialer is a dialer for webntp.
 var DefaultDialer = &websocket.Dialer{
 	Proxy:        http.ProxyFromEnvironment,
-	Subprotocols: []string{Subprotocol},
+	Subprotocols: []string{SubprotocolNTP, Subprotocol},
 }
 
 // Result is the result of synchronization.
@@ -40,19 +61,69 @@ type Result struct {
 	NextLeap  time.Time
 	TAIOffset time.Duration
 	Step      int
+
+	// Smear reports whether the server smears the leap second.
+	// If true, Offset is relative to the smeared time,
+	// and the clock should not be stepped at NextLeap.
+	Smear bool
+
+	// Stale reports whether the leap seconds list of the server is expired or missing.
+	// If true, NextLeap, TAIOffset and Step may be out of date.
+	Stale bool
+
+	// Uncertainty is the uncertainty of Offset claimed by the server.
+	// It is zero if the protocol doesn't tell it.
+	Uncertainty time.Duration
 }
 
 // Get gets synchronization information.
+// The scheme of uri selects the protocol:
+// ws and wss for WebSocket, ntp for SNTP over UDP, roughtime for Roughtime over UDP, ntp+http and ntp+https for NTP over HTTP,
+// and the others for JSON over HTTP.
 func (c *Client) Get(ctx context.Context, uri string) (Result, error) {
 	u, err := url.Parse(uri)
 	if err != nil {
 		return Result{}, err
 	}
 
-	if u.Scheme == "ws" || u.Scheme == "wss" {
-		return c.getWebsocket(ctx, uri)
+	var result Result
+	switch {
+	case u.Scheme == "ws" || u.Scheme == "wss":
+		result, err = c.getWebsocket(ctx, uri)
+	case u.Scheme == "ntp":
+		result, err = c.getNTP(ctx, u)
+	case u.Scheme == "roughtime":
+		result, err = c.getRoughtime(ctx, u)
+	case u.Scheme == "ntp+http" || u.Scheme == "ntp+https":
+		u.Scheme = strings.TrimPrefix(u.Scheme, "ntp+")
+		result, err = c.getNTPOverHTTP(ctx, u.String())
+	case c.NTPOverHTTP:
+		result, err = c.getNTPOverHTTP(ctx, uri)
+	default:
+		result, err = c.getHTTP(ctx, uri)
 	}
-	return c.getHTTP(ctx, uri)
+	if err != nil {
+		c.logger().DebugContext(ctx, "failed to get time",
+			slog.String("url", uri),
+			slog.String("protocol", u.Scheme),
+			slog.Any("err", err),
+		)
+		return Result{}, err
+	}
+	c.logger().DebugContext(ctx, "got time",
+		slog.String("url", uri),
+		slog.String("protocol", u.Scheme),
+		slog.Duration("offset", result.Offset),
+		slog.Duration("delay", result.Delay),
+	)
+	return result, nil
+}
+
+func (c *Client) logger() *slog.Logger {
+	if c.Logger == nil {
+		return slog.Default()
+	}
+	return c.Logger
 }
 
 // GetMulti gets synchronization information.
@@ -90,6 +161,11 @@ func (c *Client) GetMulti(ctx context.Context, uri string, samples int) (Result,
 	for _, r := range results {
 		if r.Delay >= minDelay*2 {
 			// the sample of this sample may be re-sent. ignore it.
+			c.logger().DebugContext(ctx, "discard the sample",
+				slog.String("url", uri),
+				slog.Duration("delay", r.Delay),
+				slog.Duration("min_delay", minDelay),
+			)
 			continue
 		}
 		delay = delay.Add(int64ToInt128(int64(r.Delay)))
@@ -154,6 +230,23 @@ func (a int128) Neg() int128 {
 }
 
 func (c *Client) getHTTP(ctx context.Context, uri string) (Result, error) {
+	var nonce string
+	if len(c.TrustedKeys) > 0 {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return Result{}, err
+		}
+		nonce, err = newNonce()
+		if err != nil {
+			return Result{}, err
+		}
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += "nonce=" + nonce
+		uri = u.String()
+	}
+
 	req, err := http.NewRequest(http.MethodGet, uri, nil)
 	if err != nil {
 		return Result{}, err
@@ -186,6 +279,11 @@ func (c *Client) getHTTP(ctx context.Context, uri string) (Result, error) {
 	if err = dec.Decode(&result); err != nil {
 		return Result{}, err
 	}
+	if len(c.TrustedKeys) > 0 {
+		if err := result.verify(c.TrustedKeys, nonce); err != nil {
+			return Result{}, err
+		}
+	}
 	ntpTime := time.Time(result.SendTime)
 	if ntpTime.IsZero() {
 		ntpTime = time.Time(result.Time) // fallback htptime
@@ -199,6 +297,8 @@ func (c *Client) getHTTP(ctx context.Context, uri string) (Result, error) {
 		NextLeap:  time.Time(result.Next),
 		TAIOffset: time.Duration(result.Leap) * time.Second,
 		Step:      result.Step,
+		Smear:     result.Smear,
+		Stale:     result.Stale,
 	}, nil
 }
 
@@ -207,15 +307,44 @@ func (c *Client) getWebsocket(ctx context.Context, uri string) (Result, error) {
 	if dialer == nil {
 		dialer = DefaultDialer
 	}
+	signed := len(c.TrustedKeys) > 0
+	if signed {
+		// NTP packets cannot be signed.
+		d := *dialer
+		d.Subprotocols = []string{Subprotocol}
+		dialer = &d
+	}
 	conn, _, err := dialer.DialContext(ctx, uri, nil)
 	if err != nil {
 		return Result{}, err
 	}
 	defer conn.Close()
 
+	if conn.Subprotocol() == SubprotocolNTP {
+		if signed {
+			return Result{}, errUnsignedProtocol
+		}
+		return c.getWebsocketNTP(conn)
+	}
+
 	// Send the request
+	var nonce string
+	if signed {
+		nonce, err = newNonce()
+		if err != nil {
+			return Result{}, err
+		}
+	}
 	start := clientStartTime()
-	b, err := Timestamp(start).MarshalJSON()
+	var b []byte
+	if signed {
+		b, err = json.Marshal(&wsRequest{
+			InitiateTime: Timestamp(start),
+			Nonce:        nonce,
+		})
+	} else {
+		b, err = Timestamp(start).MarshalJSON()
+	}
 	if err != nil {
 		return Result{}, err
 	}
@@ -226,9 +355,14 @@ func (c *Client) getWebsocket(ctx context.Context, uri string) (Result, error) {
 	// Receive the response
 	var result Response
 	if err := conn.ReadJSON(&result); err != nil {
-		return Result{}, nil
+		return Result{}, err
 	}
 	end := clientEndTime()
+	if signed {
+		if err := result.verify(c.TrustedKeys, nonce); err != nil {
+			return Result{}, err
+		}
+	}
 
 	ntpTime := time.Time(result.SendTime)
 	if ntpTime.IsZero() {
@@ -242,5 +376,44 @@ func (c *Client) getWebsocket(ctx context.Context, uri string) (Result, error) {
 		NextLeap:  time.Time(result.Next),
 		TAIOffset: time.Duration(result.Leap) * time.Second,
 		Step:      result.Step,
+		Smear:     result.Smear,
+		Stale:     result.Stale,
 	}, nil
 }
+
+func (c *Client) getWebsocketNTP(conn *websocket.Conn) (Result, error) {
+	// Send the request
+	start := clientStartTime()
+	req := &ntpPacket{
+		Version:      ntpVersion,
+		Mode:         ntpModeClient,
+		TransmitTime: toNTPTime(start),
+	}
+	b, err := req.MarshalBinary()
+	if err != nil {
+		return Result{}, err
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return Result{}, err
+	}
+
+	// Receive the response
+	messageType, b, err := conn.ReadMessage()
+	if err != nil {
+		return Result{}, err
+	}
+	end := clientEndTime()
+	if messageType != websocket.BinaryMessage {
+		return Result{}, errNotBinaryMessage
+	}
+
+	var res ntpPacket
+	if err := res.UnmarshalBinary(b); err != nil {
+		return Result{}, err
+	}
+	var ext *ntpLeapExtension
+	if e, ok := findNTPLeapExtension(b[ntpPacketSize:]); ok {
+		ext = &e
+	}
+	return ntpResult(&res, ext, req.TransmitTime, start, end)
+}
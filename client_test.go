@@ -9,11 +9,6 @@ import (
 )
 
 func TestGet(t *testing.T) {
-	defer func(f func() time.Time) { serverTime = f }(serverTime)
-	serverTime = func() time.Time {
-		return time.Unix(1234567895, 0)
-	}
-
 	defer func(f func() time.Time) { clientStartTime = f }(clientStartTime)
 	clientStartTime = func() time.Time {
 		return time.Unix(1234567890, 0)
@@ -23,7 +18,11 @@ func TestGet(t *testing.T) {
 		return time.Unix(1234567892, 0)
 	}
 
-	s := &Server{}
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Unix(1234567895, 0)
+		}),
+	}
 	s.Start()
 	defer s.Close()
 	ts := httptest.NewServer(s)
@@ -43,11 +42,6 @@ func TestGet(t *testing.T) {
 }
 
 func TestGetMulti(t *testing.T) {
-	defer func(f func() time.Time) { serverTime = f }(serverTime)
-	serverTime = func() time.Time {
-		return time.Unix(1234567895, 0)
-	}
-
 	defer func(f func() time.Time) { clientStartTime = f }(clientStartTime)
 	clientStartTime = func() time.Time {
 		return time.Unix(1234567890, 0)
@@ -57,7 +51,11 @@ func TestGetMulti(t *testing.T) {
 		return time.Unix(1234567892, 0)
 	}
 
-	s := &Server{}
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Unix(1234567895, 0)
+		}),
+	}
 	s.Start()
 	defer s.Close()
 	ts := httptest.NewServer(s)
@@ -159,11 +157,6 @@ func TestInt128Div(t *testing.T) {
 }
 
 func TestGetWebSocket(t *testing.T) {
-	defer func(f func() time.Time) { serverTime = f }(serverTime)
-	serverTime = func() time.Time {
-		return time.Unix(1234567895, 0)
-	}
-
 	defer func(f func() time.Time) { clientStartTime = f }(clientStartTime)
 	clientStartTime = func() time.Time {
 		return time.Unix(1234567890, 0)
@@ -173,7 +166,11 @@ func TestGetWebSocket(t *testing.T) {
 		return time.Unix(1234567892, 0)
 	}
 
-	s := &Server{}
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Unix(1234567895, 0)
+		}),
+	}
 	s.Start()
 	defer s.Close()
 	ts := httptest.NewServer(s)
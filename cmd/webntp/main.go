@@ -2,20 +2,27 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
 	crand "crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/binary"
+	"encoding/pem"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/rand"
 	"net/http"
+	"os"
+	"os/signal"
 	"runtime"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/shogo82148/go-webntp"
 	"github.com/shogo82148/go-webntp/ntpdshm"
 )
@@ -26,30 +33,82 @@ var version string
 var showVersion bool
 var help bool
 var serveHost string
+var metricsHost string
+var ntpHost string
+var roughtimeHost string
+var roughtimeKeyPath string
+var roughtimeRadius time.Duration
+var genKey string
+var signingKeyPath string
+var trustedKeys string
 var allowCrossOrigin bool
-var leapSecondsPath, leapSecondsURL string
+var allowedOrigins string
+var trustedProxies string
+var strictRouting bool
+var nictCompatible bool
+var ntpStratum uint
+var ntpReferenceID string
+var pathPrefix string
+var rateLimit, wsRateLimit float64
+var rateBurst, wsRateBurst int
+var maxConcurrency int
+var leapSmear time.Duration
+var leapSecondsPath, leapSecondsURL, leapSecondsMirrors, leapSecondsFile string
+var leapSecondsLax bool
+var leapSecondsWarning time.Duration
 var samples int
+var logFormat string
+var logLevel slog.Level
 var shmUnits uint
 
 func init() {
 	flag.BoolVar(&help, "help", false, "show help")
 	flag.BoolVar(&showVersion, "version", false, "show the version")
+	flag.StringVar(&genKey, "genkey", "", "generate a new Ed25519 private key into the path for -signing-key and -roughtime-key, print the public key and exit")
+
+	// Logging options
+	flag.StringVar(&logFormat, "log-format", "text", "log format: text or json")
+	flag.TextVar(&logLevel, "log-level", slog.LevelInfo, "log level: debug, info, warn or error")
 
 	// Server options
 	flag.StringVar(&serveHost, "serve", "", "server host name")
-	flag.BoolVar(&allowCrossOrigin, "allow-cross-origin", false, "allow cross origin request")
+	flag.StringVar(&ntpHost, "ntp", "", "listen address for the NTP server over UDP, e.g. :123")
+	flag.StringVar(&roughtimeHost, "roughtime", "", "listen address for the Roughtime server over UDP, e.g. :2002 (requires -roughtime-key)")
+	flag.StringVar(&roughtimeKeyPath, "roughtime-key", "", "path of the PEM encoded Ed25519 long-term private key of the Roughtime server")
+	flag.DurationVar(&roughtimeRadius, "roughtime-radius", time.Second, "uncertainty of Roughtime responses")
+	flag.StringVar(&signingKeyPath, "signing-key", "", "path of the PEM encoded Ed25519 private key to sign JSON responses")
+	flag.StringVar(&metricsHost, "metrics", "", "listen address for the Prometheus metrics endpoint")
+	flag.BoolVar(&allowCrossOrigin, "allow-cross-origin", false, "allow cross origin request from any origin (same as -allowed-origins '*')")
+	flag.StringVar(&allowedOrigins, "allowed-origins", "", "comma-separated list of allowed origins, e.g. https://example.com,https://*.example.org")
+	flag.BoolVar(&strictRouting, "strict-routing", false, "route requests by path: /.well-known/time and -path-prefix")
+	flag.StringVar(&pathPrefix, "path-prefix", "", "path of the JSON and WebSocket API (implies -strict-routing)")
+	flag.BoolVar(&nictCompatible, "nict-compat", false, "enable NICT compatible query parameters, JSONP and paths")
+	flag.UintVar(&ntpStratum, "ntp-stratum", 10, "stratum of NTP responses, e.g. the stratum of the upstream of the system clock plus one")
+	flag.StringVar(&ntpReferenceID, "ntp-refid", "WNTP", "reference identifier of NTP responses")
+	flag.Float64Var(&rateLimit, "rate-limit", 0, "maximum HTTP requests per second per client IP address (0 means no limit)")
+	flag.IntVar(&rateBurst, "rate-burst", 0, "burst size of -rate-limit")
+	flag.StringVar(&trustedProxies, "trusted-proxies", "", "comma-separated list of reverse proxies whose X-Forwarded-For is trusted by -rate-limit, e.g. 10.0.0.0/8,192.0.2.1")
+	flag.Float64Var(&wsRateLimit, "ws-rate-limit", 0, "maximum messages per second per WebSocket connection (0 means no limit)")
+	flag.IntVar(&wsRateBurst, "ws-rate-burst", 0, "burst size of -ws-rate-limit")
+	flag.IntVar(&maxConcurrency, "max-concurrency", 0, "maximum number of concurrent requests and WebSocket connections (0 means no limit)")
+	flag.DurationVar(&leapSmear, "leap-smear", 0, "window of the leap smear centered at leap seconds, e.g. 24h for noon-to-noon (0 means no smear)")
 	flag.StringVar(&leapSecondsPath, "leap-second-path", "leap-seconds.list", "path for leap-seconds.list cache")
 	flag.StringVar(&leapSecondsURL, "leap-second-url", "https://www.ietf.org/timezones/data/leap-seconds.list", "url for leap-seconds.list")
+	flag.StringVar(&leapSecondsMirrors, "leap-second-mirrors", "", "comma-separated list of mirror urls of -leap-second-url; the newest list among them is used")
+	flag.BoolVar(&leapSecondsLax, "leap-second-lax", false, "accept leap-seconds.list without the valid hash")
+	flag.DurationVar(&leapSecondsWarning, "leap-second-warning", 14*24*time.Hour, "warn if the leap seconds list expires within the duration")
+	flag.StringVar(&leapSecondsFile, "leap-second-file", "", "read leap seconds from the local file instead of fetching -leap-second-url, e.g. /usr/share/zoneinfo/leapseconds (leap-seconds.list, tzdata leapseconds, right/UTC or IERS Bulletin C)")
 
 	// Client options
 	flag.IntVar(&samples, "p", 4, "Specify the number of samples")
 	flag.UintVar(&shmUnits, "shm", 0, "ntpd shared-memory-segment")
+	flag.StringVar(&trustedKeys, "trusted-keys", "", "comma-separated list of base64 encoded Ed25519 public keys; reject the responses not signed by them")
 }
 
 func main() {
 	flag.Parse()
 
-	if serveHost == "" && flag.NArg() == 0 {
+	if serveHost == "" && ntpHost == "" && roughtimeHost == "" && genKey == "" && flag.NArg() == 0 {
 		help = true
 	}
 	if showVersion {
@@ -61,20 +120,36 @@ func main() {
 		return
 	}
 
-	if serveHost != "" {
+	logger, err := newLogger(logFormat, logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	if genKey != "" {
+		pub, err := generateKey(genKey)
+		if err != nil {
+			fatal("failed to generate the key", err)
+		}
+		fmt.Println(base64.StdEncoding.EncodeToString(pub))
+		return
+	}
+
+	if serveHost != "" || ntpHost != "" || roughtimeHost != "" {
 		if err := serve(); err != nil {
-			log.Fatal(err)
+			fatal("failed to serve", err)
 		}
 	} else if shmUnits == 0 {
 		if samples < 1 || samples > 8 {
-			log.Fatalf("invalid samples: %d", samples)
+			fatal("invalid samples", fmt.Errorf("samples must be between 1 and 8: %d", samples))
 		}
 		if _, err := client(flag.Args()); err != nil {
-			log.Fatal(err)
+			fatal("failed to synchronize", err)
 		}
 	} else {
 		if samples < 1 || samples > 8 {
-			log.Fatalf("invalid samples: %d", samples)
+			fatal("invalid samples", fmt.Errorf("samples must be between 1 and 8: %d", samples))
 		}
 
 		// init random source.
@@ -88,10 +163,10 @@ func main() {
 			var err error
 			var result webntp.Result
 			if result, err = client(flag.Args()); err != nil {
-				log.Println(err)
+				slog.Error("failed to synchronize", slog.Any("err", err))
 			}
 			if err = setClock(result); err != nil {
-				log.Println(err)
+				slog.Error("failed to set the clock", slog.Uint64("shm", uint64(shmUnits)), slog.Any("err", err))
 			}
 			d := r.Int63n(int64(2 * time.Second))
 			time.Sleep(59*time.Second + time.Duration(d))
@@ -100,20 +175,190 @@ func main() {
 }
 
 func serve() error {
+	if ntpStratum < 1 || ntpStratum > 15 {
+		return fmt.Errorf("invalid ntp stratum: %d", ntpStratum)
+	}
+	if leapSecondsFile != "" {
+		// never fetch, so the local file is never overwritten.
+		if _, err := os.Stat(leapSecondsFile); err != nil {
+			return err
+		}
+		leapSecondsPath, leapSecondsURL, leapSecondsMirrors = leapSecondsFile, "", ""
+	}
 	s := &webntp.Server{
-		LeapSecondsPath: leapSecondsPath,
-		LeapSecondsURL:  leapSecondsURL,
+		LeapSecondsPath:    leapSecondsPath,
+		LeapSecondsURL:     leapSecondsURL,
+		LaxLeapSecondsList: leapSecondsLax,
+		LeapSecondsWarning: leapSecondsWarning,
+		RequestRateLimit: webntp.RateLimit{
+			Rate:  rateLimit,
+			Burst: rateBurst,
+		},
+		MessageRateLimit: webntp.RateLimit{
+			Rate:  wsRateLimit,
+			Burst: wsRateBurst,
+		},
+		MaxConcurrency:  maxConcurrency,
+		LeapSmear:       leapSmear,
+		NICTCompatible:  nictCompatible,
+		Stratum:         uint8(ntpStratum),
+		ReferenceID:     ntpReferenceID,
+		RoughtimeRadius: roughtimeRadius,
+	}
+	if signingKeyPath != "" {
+		key, err := loadKey(signingKeyPath)
+		if err != nil {
+			return err
+		}
+		s.SigningKey = key
+	}
+	if roughtimeHost != "" {
+		if roughtimeKeyPath == "" {
+			return errors.New("-roughtime-key is required for the roughtime server")
+		}
+		key, err := loadKey(roughtimeKeyPath)
+		if err != nil {
+			return err
+		}
+		s.RoughtimeKey = key
+	}
+	for _, u := range strings.Split(leapSecondsMirrors, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			s.LeapSecondsMirrors = append(s.LeapSecondsMirrors, u)
+		}
 	}
 	if allowCrossOrigin {
-		s.Upgrader = &websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
-			Subprotocols:    []string{webntp.Subprotocol},
-			CheckOrigin:     func(*http.Request) bool { return true },
+		s.AllowedOrigins = []string{"*"}
+	} else if allowedOrigins != "" {
+		for _, origin := range strings.Split(allowedOrigins, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				s.AllowedOrigins = append(s.AllowedOrigins, origin)
+			}
 		}
 	}
-	s.Start()
-	return http.ListenAndServe(serveHost, s)
+	if trustedProxies != "" {
+		for _, proxy := range strings.Split(trustedProxies, ",") {
+			if proxy = strings.TrimSpace(proxy); proxy != "" {
+				s.TrustedProxies = append(s.TrustedProxies, proxy)
+			}
+		}
+	}
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	slog.Info("using the leap seconds list", slog.String("source", s.LeapSecondsSource()))
+
+	// reload the leap seconds on SIGHUP.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			err := s.ReloadLeapSeconds()
+			if errors.Is(err, webntp.ErrLeapSecondsNotNewer) {
+				slog.Info("kept the active leap seconds, the file is not newer", slog.String("path", s.LeapSecondsPath), slog.String("source", s.LeapSecondsSource()))
+				continue
+			}
+			if err != nil {
+				slog.Error("failed to reload leap seconds", slog.String("path", s.LeapSecondsPath), slog.Any("err", err))
+				continue
+			}
+			slog.Info("reloaded leap seconds", slog.String("source", s.LeapSecondsSource()))
+		}
+	}()
+
+	errCh := make(chan error, 4)
+	if metricsHost != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", s.MetricsHandler())
+		mux.Handle(webntp.HealthPath, s.HealthHandler())
+		go func() {
+			errCh <- fmt.Errorf("metrics: %w", http.ListenAndServe(metricsHost, mux))
+		}()
+	}
+	if ntpHost != "" {
+		go func() {
+			errCh <- fmt.Errorf("ntp: %w", s.ListenAndServeNTP(ntpHost))
+		}()
+	}
+	if roughtimeHost != "" {
+		go func() {
+			errCh <- fmt.Errorf("roughtime: %w", s.ListenAndServeRoughtime(roughtimeHost))
+		}()
+	}
+	if serveHost != "" {
+		var h http.Handler = s
+		if strictRouting || pathPrefix != "" {
+			h = s.Router(pathPrefix)
+		}
+		go func() {
+			errCh <- http.ListenAndServe(serveHost, h)
+		}()
+	}
+	return <-errCh
+}
+
+// generateKey generates a new Ed25519 key pair and writes the private key into path.
+// It doesn't overwrite the existing file.
+func generateKey(path string) (ed25519.PublicKey, error) {
+	pub, key, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+// loadKey loads the PEM encoded Ed25519 private key.
+func loadKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: no private key found", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 private key", path)
+	}
+	return edKey, nil
+}
+
+func newLogger(format string, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{
+		Level: level,
+	}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format: %q", format)
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, slog.Any("err", err))
+	os.Exit(1)
 }
 
 func client(hosts []string) (webntp.Result, error) {
@@ -123,6 +368,16 @@ func client(hosts []string) (webntp.Result, error) {
 	bestHost := ""
 
 	c := &webntp.Client{}
+	for _, key := range strings.Split(trustedKeys, ",") {
+		if key = strings.TrimSpace(key); key == "" {
+			continue
+		}
+		pub, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return webntp.Result{}, fmt.Errorf("invalid trusted key: %q", key)
+		}
+		c.TrustedKeys = append(c.TrustedKeys, ed25519.PublicKey(pub))
+	}
 	for _, arg := range hosts {
 		result, err := c.GetMulti(context.Background(), arg, samples)
 		if err != nil {
@@ -134,6 +389,9 @@ func client(hosts []string) (webntp.Result, error) {
 				result.Offset.Seconds(),
 				result.Delay.Seconds(),
 			)
+			if result.Stale {
+				fmt.Printf("server %s, warning: the leap seconds list of the server is out of date\n", arg)
+			}
 			if result.Delay < best.Delay {
 				best = result
 				bestHost = arg
@@ -177,6 +435,11 @@ func setClock(result webntp.Result) error {
 	shm.SetPrecision(precision)
 
 	// set leap second indicator
+	if result.Smear {
+		// the server has absorbed the leap second.
+		shm.SetLeap(ntpdshm.LeapNoWarning)
+		return nil
+	}
 	leap := result.NextLeap.Sub(remote)
 	if leap <= 0 {
 		shm.SetLeap(ntpdshm.LeapNoWarning)
@@ -0,0 +1,124 @@
+package webntp
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// allowOrigin reports whether origin is in s.AllowedOrigins.
+func (s *Server) allowOrigin(origin string) bool {
+	for _, pattern := range s.AllowedOrigins {
+		if matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin reports whether origin matches pattern.
+// pattern is "*", an exact origin such as "https://example.com",
+// or an origin with a wildcard subdomain such as "https://*.example.com".
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" {
+		return true
+	}
+	pattern = strings.ToLower(pattern)
+	origin = strings.ToLower(origin)
+	prefix, suffix, ok := strings.Cut(pattern, "*")
+	if !ok {
+		return pattern == origin
+	}
+	if len(origin) <= len(prefix)+len(suffix) {
+		return false
+	}
+	if !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	sub := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.ContainsAny(sub, "/:@")
+}
+
+func (s *Server) anyOrigin() bool {
+	for _, pattern := range s.AllowedOrigins {
+		if pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// handleCORS sets the CORS headers.
+// It reports whether the request is a preflight request and the response has been written.
+func (s *Server) handleCORS(rw http.ResponseWriter, req *http.Request) bool {
+	if len(s.AllowedOrigins) == 0 || websocket.IsWebSocketUpgrade(req) {
+		return false
+	}
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	preflight := req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != ""
+
+	h := rw.Header()
+	if !s.allowOrigin(origin) {
+		if preflight {
+			http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return true
+		}
+		return false
+	}
+	if s.anyOrigin() {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Add("Vary", "Origin")
+	}
+	h.Set("Access-Control-Expose-Headers", "X-HTTPSTIME")
+
+	if !preflight {
+		return false
+	}
+	h.Set("Access-Control-Allow-Methods", "GET, HEAD")
+	if headers := req.Header.Get("Access-Control-Request-Headers"); headers != "" {
+		h.Set("Access-Control-Allow-Headers", headers)
+	}
+	h.Set("Access-Control-Max-Age", "86400")
+	rw.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// checkOrigin is websocket.Upgrader.CheckOrigin that applies s.AllowedOrigins.
+func (s *Server) checkOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		// non-browser clients
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, req.Host) {
+		return true
+	}
+	return s.allowOrigin(origin)
+}
+
+func (s *Server) upgrader() *websocket.Upgrader {
+	if s.Upgrader != nil {
+		return s.Upgrader
+	}
+	base := defaultUpgrader
+	if s.LeapSmear > 0 {
+		base = smearUpgrader
+	}
+	if len(s.AllowedOrigins) == 0 {
+		return base
+	}
+	u := *base
+	u.CheckOrigin = s.checkOrigin
+	return &u
+}
@@ -0,0 +1,172 @@
+package webntp
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{"*", "https://example.com", true},
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "https://EXAMPLE.com", true},
+		{"https://example.com", "http://example.com", false},
+		{"https://example.com", "https://example.com:8443", false},
+		{"https://*.example.com", "https://foo.example.com", true},
+		{"https://*.example.com", "https://foo.bar.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://.example.com", false},
+		{"https://*.example.com", "https://evil.com/.example.com", false},
+		{"https://*.example.com", "https://evil.com:.example.com", false},
+		{"https://*.example.com", "https://fooexample.com", false},
+	}
+	for _, tc := range testCases {
+		if got := matchOrigin(tc.pattern, tc.origin); got != tc.want {
+			t.Errorf("matchOrigin(%q, %q): want %t, got %t", tc.pattern, tc.origin, tc.want, got)
+		}
+	}
+}
+
+func TestServer_CORS(t *testing.T) {
+	s := &Server{
+		AllowedOrigins: []string{"https://example.com", "https://*.example.org"},
+	}
+	s.Start()
+	defer s.Close()
+
+	t.Run("allowed origin", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/?1234567890", nil)
+		req.Header.Set("Origin", "https://www.example.org")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("unexpected status code: want %d, got %d", http.StatusOK, w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://www.example.org" {
+			t.Errorf("unexpected Access-Control-Allow-Origin: %q", got)
+		}
+		if got := w.Header().Get("Access-Control-Expose-Headers"); got != "X-HTTPSTIME" {
+			t.Errorf("unexpected Access-Control-Expose-Headers: %q", got)
+		}
+		if got := w.Header().Get("Vary"); got != "Origin" {
+			t.Errorf("unexpected Vary: %q", got)
+		}
+	})
+
+	t.Run("disallowed origin", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/?1234567890", nil)
+		req.Header.Set("Origin", "https://example.net")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("unexpected Access-Control-Allow-Origin: %q", got)
+		}
+	})
+
+	t.Run("preflight", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "http://localhost/", nil)
+		req.Header.Set("Origin", "https://example.com")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		req.Header.Set("Access-Control-Request-Headers", "cache-control")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Errorf("unexpected status code: want %d, got %d", http.StatusNoContent, w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://example.com" {
+			t.Errorf("unexpected Access-Control-Allow-Origin: %q", got)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, HEAD" {
+			t.Errorf("unexpected Access-Control-Allow-Methods: %q", got)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Headers"); got != "cache-control" {
+			t.Errorf("unexpected Access-Control-Allow-Headers: %q", got)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("unexpected body: %q", w.Body.String())
+		}
+	})
+
+	t.Run("disallowed preflight", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "http://localhost/", nil)
+		req.Header.Set("Origin", "https://example.net")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("unexpected status code: want %d, got %d", http.StatusForbidden, w.Code)
+		}
+	})
+}
+
+func TestServer_CORS_any(t *testing.T) {
+	s := &Server{
+		AllowedOrigins: []string{"*"},
+	}
+	s.Start()
+	defer s.Close()
+
+	req := httptest.NewRequest(http.MethodHead, "http://localhost/.well-known/time", nil)
+	req.Header.Set("Origin", "https://example.com")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("unexpected Access-Control-Allow-Origin: %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != "X-HTTPSTIME" {
+		t.Errorf("unexpected Access-Control-Expose-Headers: %q", got)
+	}
+}
+
+func TestServer_CORS_WebSocket(t *testing.T) {
+	s := &Server{
+		Logger:         slog.New(slog.DiscardHandler),
+		AllowedOrigins: []string{"https://*.example.com"},
+	}
+	s.Start()
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	dialer := &websocket.Dialer{
+		Subprotocols: []string{Subprotocol},
+	}
+
+	testCases := []struct {
+		origin string
+		ok     bool
+	}{
+		{"", true},
+		{"https://www.example.com", true},
+		{"https://example.net", false},
+		{ts.URL, true}, // same origin
+	}
+	for _, tc := range testCases {
+		h := http.Header{}
+		if tc.origin != "" {
+			h.Set("Origin", tc.origin)
+		}
+		conn, _, err := dialer.Dial(u.String(), h)
+		if tc.ok {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", tc.origin, err)
+				continue
+			}
+			conn.Close()
+		} else if err == nil {
+			conn.Close()
+			t.Errorf("%q: want error, got nil", tc.origin)
+		}
+	}
+}
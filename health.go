@@ -0,0 +1,151 @@
+package webntp
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// HealthPath is the path of the health endpoint in Router.
+const HealthPath = "/healthz"
+
+// defaultLeapSecondsWarning is the default of Server.LeapSecondsWarning.
+const defaultLeapSecondsWarning = 14 * 24 * time.Hour
+
+// the statuses of LeapSecondsStatus.
+const (
+	// LeapSecondsStatusOK means the leap seconds list is valid.
+	LeapSecondsStatusOK = "ok"
+
+	// LeapSecondsStatusWarning means the leap seconds list expires within Server.LeapSecondsWarning.
+	LeapSecondsStatusWarning = "warning"
+
+	// LeapSecondsStatusExpired means the leap seconds list has been expired.
+	LeapSecondsStatusExpired = "expired"
+
+	// LeapSecondsStatusMissing means the server has no leap seconds list.
+	LeapSecondsStatusMissing = "missing"
+
+	// LeapSecondsStatusNoExpiry means the leap seconds list has no expiration date, e.g. TZif files.
+	// The server can't tell whether the list is up to date, but it is not treated as expired.
+	LeapSecondsStatusNoExpiry = "no_expiry"
+)
+
+// LeapSecondsStatus is the status of the leap seconds list of the Server.
+type LeapSecondsStatus struct {
+	// Status is one of LeapSecondsStatusOK, LeapSecondsStatusWarning, LeapSecondsStatusExpired,
+	// LeapSecondsStatusMissing and LeapSecondsStatusNoExpiry.
+	Status string `json:"status"`
+
+	// Source is the source of the list. See Server.LeapSecondsSource.
+	Source string `json:"source"`
+
+	// UpdateAt and ExpireAt are the dates of the list. They are zero if the list doesn't have them.
+	UpdateAt time.Time `json:"update_at,omitzero"`
+	ExpireAt time.Time `json:"expire_at,omitzero"`
+
+	// LastFetch is the time of the last fetch of leap-seconds.list.
+	// It is zero if the server has never fetched.
+	LastFetch time.Time `json:"last_fetch,omitzero"`
+
+	// LastFetchError is the error of the last fetch. It is empty if the last fetch succeeded.
+	LastFetchError string `json:"last_fetch_error,omitempty"`
+}
+
+// LeapSecondsStatus returns the status of the leap seconds list at the time of the Clock.
+func (s *Server) LeapSecondsStatus() LeapSecondsStatus {
+	return s.leapSecondsStatus(s.now())
+}
+
+func (s *Server) leapSecondsStatus(now time.Time) LeapSecondsStatus {
+	s.leapSecondsMu.Lock()
+	defer s.leapSecondsMu.Unlock()
+
+	status := LeapSecondsStatus{
+		Source:    s.leapSecondsSource,
+		LastFetch: s.lastFetch,
+	}
+	if s.lastFetchErr != nil {
+		status.LastFetchError = s.lastFetchErr.Error()
+	}
+	list, ok := s.leapSecondsList.Load().(*LeapSecondsList)
+	if !ok {
+		status.Status = LeapSecondsStatusMissing
+		return status
+	}
+	status.UpdateAt = list.UpdateAt
+	status.ExpireAt = list.ExpireAt
+	switch {
+	case list.ExpireAt.IsZero():
+		status.Status = LeapSecondsStatusNoExpiry
+	case now.After(list.ExpireAt):
+		status.Status = LeapSecondsStatusExpired
+	case now.After(list.ExpireAt.Add(-s.leapSecondsWarning())):
+		status.Status = LeapSecondsStatusWarning
+	default:
+		status.Status = LeapSecondsStatusOK
+	}
+	return status
+}
+
+// HealthHandler returns a handler that reports LeapSecondsStatus in JSON.
+// It responds 503 Service Unavailable if the list is expired or missing, otherwise 200 OK.
+func (s *Server) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		status := s.LeapSecondsStatus()
+		data, err := json.Marshal(status)
+		if err != nil {
+			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+		rw.Header().Set("Cache-Control", "no-cache, no-store")
+		if status.Status == LeapSecondsStatusExpired || status.Status == LeapSecondsStatusMissing {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+		rw.Write(data)
+	})
+}
+
+func (s *Server) leapSecondsWarning() time.Duration {
+	if s.LeapSecondsWarning == 0 {
+		return defaultLeapSecondsWarning
+	}
+	return s.LeapSecondsWarning
+}
+
+// leapSecondsStale reports whether the leap seconds list is expired or missing at now.
+// The list without the expiration date is not stale.
+func (s *Server) leapSecondsStale(now time.Time) bool {
+	list, ok := s.leapSecondsList.Load().(*LeapSecondsList)
+	return !ok || (!list.ExpireAt.IsZero() && now.After(list.ExpireAt))
+}
+
+// recordFetch records the result of fetching leap-seconds.list for LeapSecondsStatus.
+func (s *Server) recordFetch(now time.Time, err error) {
+	s.leapSecondsMu.Lock()
+	defer s.leapSecondsMu.Unlock()
+	s.lastFetch = now
+	s.lastFetchErr = err
+}
+
+// warnLeapSecondsExpiry logs if the leap seconds list is expiring or expired at now.
+func (s *Server) warnLeapSecondsExpiry(now time.Time) {
+	status := s.leapSecondsStatus(now)
+	attrs := []any{
+		slog.String("source", status.Source),
+		slog.Time("expire_at", status.ExpireAt),
+	}
+	if status.LastFetchError != "" {
+		attrs = append(attrs, slog.String("last_fetch_error", status.LastFetchError))
+	}
+	switch status.Status {
+	case LeapSecondsStatusWarning:
+		s.logger().Warn("the leap seconds list expires soon", attrs...)
+	case LeapSecondsStatusExpired:
+		s.logger().Error("the leap seconds list has been expired", attrs...)
+	case LeapSecondsStatusMissing:
+		s.logger().Error("no leap seconds list", attrs...)
+	}
+}
@@ -0,0 +1,222 @@
+package webntp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_LeapSecondsStatus(t *testing.T) {
+	// the embedded list expires on 2026-06-28.
+	tests := []struct {
+		now  time.Time
+		want string
+	}{
+		{time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC), LeapSecondsStatusOK},
+		{time.Date(2026, time.June, 20, 0, 0, 0, 0, time.UTC), LeapSecondsStatusWarning},
+		{time.Date(2026, time.July, 1, 0, 0, 0, 0, time.UTC), LeapSecondsStatusExpired},
+	}
+	for _, tc := range tests {
+		t.Run(tc.now.Format(time.DateOnly), func(t *testing.T) {
+			s := &Server{
+				Clock: ClockFunc(func() time.Time {
+					return tc.now
+				}),
+			}
+			s.Start()
+			defer s.Close()
+
+			status := s.LeapSecondsStatus()
+			if status.Status != tc.want {
+				t.Errorf("want %q, got %q", tc.want, status.Status)
+			}
+			if status.Source != LeapSecondsSourceEmbedded {
+				t.Errorf("want %q, got %q", LeapSecondsSourceEmbedded, status.Source)
+			}
+			if !status.LastFetch.IsZero() {
+				t.Errorf("want zero, got %s", status.LastFetch)
+			}
+		})
+	}
+}
+
+func TestServer_LeapSecondsStatus_Warning(t *testing.T) {
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Date(2026, time.May, 1, 0, 0, 0, 0, time.UTC)
+		}),
+		LeapSecondsWarning: 60 * 24 * time.Hour,
+	}
+	s.Start()
+	defer s.Close()
+
+	if got := s.LeapSecondsStatus().Status; got != LeapSecondsStatusWarning {
+		t.Errorf("want %q, got %q", LeapSecondsStatusWarning, got)
+	}
+}
+
+func TestServer_LeapSecondsStatus_Missing(t *testing.T) {
+	s := &Server{}
+	if got := s.LeapSecondsStatus().Status; got != LeapSecondsStatusMissing {
+		t.Errorf("want %q, got %q", LeapSecondsStatusMissing, got)
+	}
+}
+
+func TestServer_HealthHandler(t *testing.T) {
+	now := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return now
+		}),
+	}
+	s.Start()
+	defer s.Close()
+	fetched := time.Date(2025, time.December, 31, 0, 0, 0, 0, time.UTC)
+	s.recordFetch(fetched, errors.New("connection refused"))
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com"+HealthPath, nil)
+	w := httptest.NewRecorder()
+	s.HealthHandler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("want %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+		t.Errorf("unexpected Content-Type: %s", got)
+	}
+
+	var status LeapSecondsStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != LeapSecondsStatusOK {
+		t.Errorf("want %q, got %q", LeapSecondsStatusOK, status.Status)
+	}
+	if want := time.Date(2026, time.June, 28, 0, 0, 0, 0, time.UTC); !status.ExpireAt.Equal(want) {
+		t.Errorf("want %s, got %s", want, status.ExpireAt)
+	}
+	if !status.LastFetch.Equal(fetched) {
+		t.Errorf("want %s, got %s", fetched, status.LastFetch)
+	}
+	if status.LastFetchError != "connection refused" {
+		t.Errorf("want %q, got %q", "connection refused", status.LastFetchError)
+	}
+}
+
+func TestServer_HealthHandler_Expired(t *testing.T) {
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+		}),
+	}
+	s.Start()
+	defer s.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com"+HealthPath, nil)
+	w := httptest.NewRecorder()
+	s.Router("").ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("want %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
+
+func TestServer_Stale(t *testing.T) {
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+		}),
+	}
+	s.Start()
+	defer s.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/?1234567890.0", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+
+	var res Response
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if !res.Stale {
+		t.Error("want stale, got not stale")
+	}
+}
+
+func TestServer_NoExpiry(t *testing.T) {
+	// TZif files have no expiration date.
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+		}),
+		LeapSecondsPath: "testdata/right-UTC-2025b",
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com"+HealthPath, nil)
+	w := httptest.NewRecorder()
+	s.Router("").ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("want %d, got %d", http.StatusOK, w.Code)
+	}
+	var status map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status["status"] != LeapSecondsStatusNoExpiry {
+		t.Errorf("want %q, got %v", LeapSecondsStatusNoExpiry, status["status"])
+	}
+	if _, ok := status["expire_at"]; ok {
+		t.Errorf("want no expire_at, got %v", status["expire_at"])
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/?1234567890.0", nil)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	var res Response
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Stale {
+		t.Error("want not stale, got stale")
+	}
+
+	w = httptest.NewRecorder()
+	s.MetricsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/metrics", nil))
+	if strings.Contains(w.Body.String(), "webntp_leap_seconds_expire_timestamp_seconds") {
+		t.Errorf("want no expiration gauge, got:\n%s", w.Body.String())
+	}
+}
+
+func TestClient_Stale(t *testing.T) {
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+		}),
+	}
+	s.Start()
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	// ws:// negotiates the NTP subprotocol, which carries the flag in the leap second extension.
+	for _, scheme := range []string{"http", "ws", "ntp+http"} {
+		t.Run(scheme, func(t *testing.T) {
+			u := scheme + strings.TrimPrefix(ts.URL, "http")
+			c := &Client{}
+			result, err := c.Get(context.Background(), u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Stale {
+				t.Error("want stale, got not stale")
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package webntp
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// LeapSecondsJSONPath is the path of the leap seconds API in Router.
+	LeapSecondsJSONPath = "/leap-seconds.json"
+
+	// LeapSecondsListPath is the path of the leap-seconds.list mirror in Router.
+	LeapSecondsListPath = "/leap-seconds.list"
+)
+
+// LeapSecondsResponse is the response of LeapSecondsHandler.
+type LeapSecondsResponse struct {
+	// Source is the source of the list. See Server.LeapSecondsSource.
+	Source string `json:"source"`
+
+	// UpdateAt and ExpireAt are the dates of the list, omitted if the list doesn't have them, e.g. TZif files.
+	UpdateAt Timestamp `json:"update_at,omitzero"`
+	ExpireAt Timestamp `json:"expire_at,omitzero"`
+
+	// LeapSeconds are all the leap seconds in the list.
+	LeapSeconds []LeapSecondEvent `json:"leap_seconds"`
+}
+
+// LeapSecondEvent is a leap second in LeapSecondsResponse.
+type LeapSecondEvent struct {
+	// At is the end of the leap second, i.e. midnight of the next day.
+	At Timestamp `json:"at"`
+
+	// Leap is TAI - UTC before At.
+	Leap int `json:"leap"`
+
+	// Step is 1 for insertion, -1 for deletion.
+	Step int `json:"step"`
+}
+
+// LeapSecondsAtResponse is the response of LeapSecondsHandler with the "at" query parameter.
+type LeapSecondsAtResponse struct {
+	// At is the instant of the query.
+	At Timestamp `json:"at"`
+
+	// TAIMinusUTC is TAI - UTC at At.
+	TAIMinusUTC int `json:"tai_utc"`
+
+	// Next and Step are the next or last leap second as in Response.
+	Next Timestamp `json:"next"`
+	Step int       `json:"step"`
+
+	// Expired is true if At is after the expiration date of the list,
+	// so TAIMinusUTC may be wrong.
+	Expired bool `json:"expired,omitempty"`
+}
+
+// LeapSecondsHandler returns a handler that serves the active leap seconds list in JSON (LeapSecondsResponse).
+// With the "at" query parameter of a unix timestamp, e.g. "?at=1483228800",
+// it serves TAI - UTC at the instant (LeapSecondsAtResponse) instead.
+// The instant must be after 1 January 1972.
+func (s *Server) LeapSecondsHandler() http.Handler {
+	return s.handler(func(rw http.ResponseWriter, req *http.Request) {
+		if !allowGet(rw, req) {
+			return
+		}
+		list, source := s.activeLeapSeconds()
+		if list == nil || len(list.LeapSeconds) == 0 {
+			http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+
+		var res any
+		if raw := req.URL.Query().Get("at"); raw != "" {
+			var at Timestamp
+			if err := at.UnmarshalJSON([]byte(strings.TrimSpace(raw))); err != nil {
+				http.Error(rw, "invalid at", http.StatusBadRequest)
+				return
+			}
+			t := time.Time(at)
+			if t.Before(leapSecondsEpoch) {
+				http.Error(rw, "at must be after 1 January 1972", http.StatusBadRequest)
+				return
+			}
+			leap := list.leapSecond(t)
+			res = &LeapSecondsAtResponse{
+				At:          at,
+				TAIMinusUTC: list.TAIMinusUTC(t),
+				Next:        Timestamp(leap.At),
+				Step:        leap.Step,
+				Expired:     !list.ValidAt(t),
+			}
+		} else {
+			events := make([]LeapSecondEvent, 0, len(list.LeapSeconds))
+			for _, leap := range list.LeapSeconds {
+				events = append(events, LeapSecondEvent{
+					At:   Timestamp(leap.At),
+					Leap: leap.Leap,
+					Step: leap.Step,
+				})
+			}
+			res = &LeapSecondsResponse{
+				Source:      source,
+				UpdateAt:    Timestamp(list.UpdateAt),
+				ExpireAt:    Timestamp(list.ExpireAt),
+				LeapSeconds: events,
+			}
+		}
+
+		data, err := json.Marshal(res)
+		if err != nil {
+			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+		rw.Header().Set("Cache-Control", "no-cache")
+		rw.Write(append(data, '\n'))
+	})
+}
+
+// LeapSecondsListHandler returns a handler that serves the active leap seconds list
+// in the format of leap-seconds.list, so that the server works as a mirror of leap-seconds.list.
+// It serves the original file as is if the source is leap-seconds.list: the embedded one, the fetched one or LeapSecondsPath.
+// Last-Modified is the update date of the embedded list, Last-Modified of the fetched one, or the modification time of the file.
+// The lists in the other formats are written by LeapSecondsList.WriteTo.
+// It supports the conditional requests with ETag, which is the hash of the content, and Last-Modified.
+func (s *Server) LeapSecondsListHandler() http.Handler {
+	return s.handler(func(rw http.ResponseWriter, req *http.Request) {
+		if !allowGet(rw, req) {
+			return
+		}
+		s.leapSecondsMu.Lock()
+		f := s.leapSecondsFile
+		s.leapSecondsMu.Unlock()
+		if f == nil || f.data == nil {
+			http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		rw.Header().Set("Cache-Control", "no-cache")
+		rw.Header().Set("ETag", f.etag)
+		http.ServeContent(rw, req, "", f.modTime, bytes.NewReader(f.data))
+	})
+}
+
+// activeLeapSeconds returns the active list and its source.
+func (s *Server) activeLeapSeconds() (*LeapSecondsList, string) {
+	s.leapSecondsMu.Lock()
+	defer s.leapSecondsMu.Unlock()
+	list, _ := s.leapSecondsList.Load().(*LeapSecondsList)
+	return list, s.leapSecondsSource
+}
+
+// allowGet responds 405 Method Not Allowed unless the method is GET or HEAD.
+func allowGet(rw http.ResponseWriter, req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		rw.Header().Set("Allow", "GET, HEAD")
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+// leapSecondsFile is the active list in the format of leap-seconds.list.
+type leapSecondsFile struct {
+	data    []byte // nil if the list cannot be written, e.g. no update date
+	etag    string
+	modTime time.Time
+}
+
+// newLeapSecondsFile returns the file of list.
+// data is the original leap-seconds.list of list. If it is nil, list is written by WriteTo.
+func newLeapSecondsFile(list *LeapSecondsList, data []byte, modTime time.Time) *leapSecondsFile {
+	if data == nil {
+		var buf bytes.Buffer
+		if _, err := list.WriteTo(&buf); err != nil {
+			return &leapSecondsFile{}
+		}
+		data = buf.Bytes()
+	}
+	sum := sha1.Sum(data)
+	return &leapSecondsFile{
+		data:    data,
+		etag:    `"` + hex.EncodeToString(sum[:]) + `"`,
+		modTime: modTime,
+	}
+}
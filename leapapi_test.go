@@ -0,0 +1,286 @@
+package webntp
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestServer_LeapSecondsHandler(t *testing.T) {
+	s := &Server{}
+	s.Start()
+	defer s.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com"+LeapSecondsJSONPath, nil)
+	w := httptest.NewRecorder()
+	s.LeapSecondsHandler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var res LeapSecondsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Source != LeapSecondsSourceEmbedded {
+		t.Errorf("want %q, got %q", LeapSecondsSourceEmbedded, res.Source)
+	}
+	list := DefaultLeapSecondsList()
+	if !time.Time(res.UpdateAt).Equal(list.UpdateAt) {
+		t.Errorf("want %s, got %s", list.UpdateAt, time.Time(res.UpdateAt))
+	}
+	if !time.Time(res.ExpireAt).Equal(list.ExpireAt) {
+		t.Errorf("want %s, got %s", list.ExpireAt, time.Time(res.ExpireAt))
+	}
+	if len(res.LeapSeconds) != len(list.LeapSeconds) {
+		t.Fatalf("want %d leap seconds, got %d", len(list.LeapSeconds), len(res.LeapSeconds))
+	}
+	for i, leap := range list.LeapSeconds {
+		got := res.LeapSeconds[i]
+		if !time.Time(got.At).Equal(leap.At) || got.Leap != leap.Leap || got.Step != leap.Step {
+			t.Errorf("#%d: want %v, got %v", i, leap, got)
+		}
+	}
+}
+
+func TestServer_LeapSecondsHandler_At(t *testing.T) {
+	s := &Server{}
+	s.Start()
+	defer s.Close()
+
+	tests := []struct {
+		at   string
+		want LeapSecondsAtResponse
+	}{
+		{
+			// 1 January 1972
+			at: "63072000",
+			want: LeapSecondsAtResponse{
+				At:          Timestamp(time.Unix(63072000, 0)),
+				TAIMinusUTC: 10,
+				Next:        Timestamp(time.Unix(78796800, 0)),
+				Step:        1,
+			},
+		},
+		{
+			// 2016-12-31T23:59:59Z
+			at: "1483228799.5",
+			want: LeapSecondsAtResponse{
+				At:          Timestamp(time.Unix(1483228799, 5e8)),
+				TAIMinusUTC: 36,
+				Next:        Timestamp(time.Unix(1483228800, 0)),
+				Step:        1,
+			},
+		},
+		{
+			// 2017-01-01T00:00:00Z
+			at: "1483228800",
+			want: LeapSecondsAtResponse{
+				At:          Timestamp(time.Unix(1483228800, 0)),
+				TAIMinusUTC: 37,
+				Next:        Timestamp(time.Unix(1483228800, 0)),
+				Step:        1,
+			},
+		},
+		{
+			// 2027-01-01T00:00:00Z, after the expiration
+			at: "1798761600",
+			want: LeapSecondsAtResponse{
+				At:          Timestamp(time.Unix(1798761600, 0)),
+				TAIMinusUTC: 37,
+				Next:        Timestamp(time.Unix(1483228800, 0)),
+				Step:        1,
+				Expired:     true,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.at, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com"+LeapSecondsJSONPath+"?at="+tc.at, nil)
+			w := httptest.NewRecorder()
+			s.LeapSecondsHandler().ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+			}
+			var got LeapSecondsAtResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			opt := cmp.Comparer(func(a, b Timestamp) bool {
+				return time.Time(a).Equal(time.Time(b))
+			})
+			if diff := cmp.Diff(tc.want, got, opt); diff != "" {
+				t.Errorf("response mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	for _, at := range []string{"foo", "0", "63071999"} {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com"+LeapSecondsJSONPath+"?at="+at, nil)
+		w := httptest.NewRecorder()
+		s.LeapSecondsHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: want %d, got %d", at, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestServer_LeapSecondsListHandler(t *testing.T) {
+	s := &Server{}
+	s.Start()
+	defer s.Close()
+	h := s.LeapSecondsListHandler()
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com"+LeapSecondsListPath, nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+	}
+	got, err := ParseLeapSecondsList(strings.NewReader(w.Body.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(DefaultLeapSecondsList(), got); diff != "" {
+		t.Errorf("list mismatch (-want +got):\n%s", diff)
+	}
+	// the embedded file as is.
+	if !bytes.Equal(w.Body.Bytes(), defaultLeapSecondsList) {
+		t.Error("the body is not the embedded file")
+	}
+	sum := sha1.Sum(defaultLeapSecondsList)
+	etag := w.Header().Get("ETag")
+	if want := `"` + hex.EncodeToString(sum[:]) + `"`; etag != want {
+		t.Errorf("unexpected ETag: want %s, got %s", want, etag)
+	}
+	lastModified := w.Header().Get("Last-Modified")
+	if want := got.UpdateAt.Format(http.TimeFormat); lastModified != want {
+		t.Errorf("unexpected Last-Modified: want %s, got %s", want, lastModified)
+	}
+
+	// conditional requests
+	req = httptest.NewRequest(http.MethodGet, "http://example.com"+LeapSecondsListPath, nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: want %d, got %d", http.StatusNotModified, w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com"+LeapSecondsListPath, nil)
+	req.Header.Set("If-Modified-Since", lastModified)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since: want %d, got %d", http.StatusNotModified, w.Code)
+	}
+
+	// a newer list changes the ETag.
+	expireAt := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	list, err := ParseLeapSecondsList(strings.NewReader(string(reissueLeapSecondsList(t, got.UpdateAt, expireAt))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.setLeapSecondsList(list, "test", nil, time.Now())
+	req = httptest.NewRequest(http.MethodGet, "http://example.com"+LeapSecondsListPath, nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("want %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Header().Get("ETag") == etag {
+		t.Error("ETag is not changed")
+	}
+}
+
+func TestServer_LeapSecondsListHandler_Fetched(t *testing.T) {
+	data := reissueLeapSecondsList(t, time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2030, time.December, 28, 0, 0, 0, 0, time.UTC))
+	data = append([]byte("# the comments of the original file\n"), data...)
+	const lastModified = "Tue, 01 Jan 2030 00:00:00 GMT"
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Last-Modified", lastModified)
+		rw.Write(data)
+	}))
+	defer ts.Close()
+
+	get := func(s *Server) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.LeapSecondsListHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com"+LeapSecondsListPath, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("want %d, got %d", http.StatusOK, w.Code)
+		}
+		if !bytes.Equal(w.Body.Bytes(), data) {
+			t.Errorf("the body is not the original file:\n%s", w.Body.String())
+		}
+		if got := w.Header().Get("Last-Modified"); got != lastModified {
+			t.Errorf("unexpected Last-Modified: want %s, got %s", lastModified, got)
+		}
+		return w
+	}
+
+	// fetched
+	path := filepath.Join(t.TempDir(), "leap-seconds.list")
+	s := &Server{
+		LeapSecondsPath: path,
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.LeapSecondsURL = ts.URL
+	if err := s.fetchLeapSeconds(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	etag := get(s).Header().Get("ETag")
+
+	// the cache keeps Last-Modified.
+	s2 := &Server{
+		LeapSecondsPath: path,
+	}
+	if err := s2.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+	if got := s2.LeapSecondsSource(); got != path {
+		t.Errorf("unexpected source: want %s, got %s", path, got)
+	}
+	if got := get(s2).Header().Get("ETag"); got != etag {
+		t.Errorf("unexpected ETag: want %s, got %s", etag, got)
+	}
+}
+
+func TestServer_LeapSecondsListHandler_Mirror(t *testing.T) {
+	// the server can fetch from another server.
+	origin := &Server{}
+	origin.Start()
+	defer origin.Close()
+	ts := httptest.NewServer(origin.Router(""))
+	defer ts.Close()
+
+	s := &Server{
+		LeapSecondsURL: ts.URL + LeapSecondsListPath,
+	}
+	s.Start()
+	defer s.Close()
+	if err := s.fetchLeapSeconds(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	// fetched the same list, and it is not modified.
+	if err := s.fetchLeapSeconds(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.LeapSecondsSource(); got != LeapSecondsSourceEmbedded {
+		t.Errorf("want %q, got %q", LeapSecondsSourceEmbedded, got)
+	}
+}
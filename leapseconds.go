@@ -0,0 +1,172 @@
+package webntp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// leapSecondsEpoch is the beginning of UTC with leap seconds, 1 January 1972.
+// It is the date of the first line of leap-seconds.list,
+// which defines the initial TAI - UTC rather than a leap second.
+var leapSecondsEpoch = time.Date(1972, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+//go:embed data/leap-seconds.list
+var defaultLeapSecondsList []byte
+
+// DefaultLeapSecondsList returns leap-seconds.list embedded in the package.
+// It is the latest list at the time of the release, and it may have been expired.
+func DefaultLeapSecondsList() *LeapSecondsList {
+	list, err := ParseLeapSecondsList(bytes.NewReader(defaultLeapSecondsList))
+	if err != nil {
+		panic("webntp: invalid embedded leap-seconds.list: " + err.Error())
+	}
+	return list
+}
+
+// newerThan reports whether l is newer than other.
+// The list with the later update date is newer.
+// If the update dates are the same, e.g. leap-seconds.list reissued with
+// no new leap seconds, the list with the later expiration date is newer.
+func (l *LeapSecondsList) newerThan(other *LeapSecondsList) bool {
+	if !l.UpdateAt.Equal(other.UpdateAt) {
+		return l.UpdateAt.After(other.UpdateAt)
+	}
+	return l.ExpireAt.After(other.ExpireAt)
+}
+
+// equal reports whether l and other have the same leap seconds and dates.
+func (l *LeapSecondsList) equal(other *LeapSecondsList) bool {
+	return l.UpdateAt.Equal(other.UpdateAt) && l.ExpireAt.Equal(other.ExpireAt) &&
+		slices.EqualFunc(l.LeapSeconds, other.LeapSeconds, func(a, b LeapSecond) bool {
+			return a.At.Equal(b.At) && a.Leap == b.Leap && a.Step == b.Step
+		})
+}
+
+// tzdataLeapLine matches the leap second lines of the leapseconds file of the tz database.
+var tzdataLeapLine = regexp.MustCompile(`(?m)^Leap\s`)
+
+// ParseLeapSeconds parses the leap seconds in any supported format, detected by the content:
+// TZif files compiled with leap seconds (ParseTZifLeapSeconds),
+// IERS Bulletin C (ParseBulletinC),
+// the leapseconds file of the tz database (ParseTZDataLeapSeconds),
+// and leap-seconds.list (ParseLeapSecondsList).
+func ParseLeapSeconds(r io.Reader) (*LeapSecondsList, error) {
+	return parseLeapSeconds(r, false)
+}
+
+func parseLeapSeconds(r io.Reader, lax bool) (*LeapSecondsList, error) {
+	data, err := readLeapSeconds(r)
+	if err != nil {
+		return nil, err
+	}
+	if parse := otherLeapSecondsParser(data); parse != nil {
+		return parse(bytes.NewReader(data))
+	}
+	return parseLeapSecondsList(bytes.NewReader(data), lax)
+}
+
+// otherLeapSecondsParser returns the parser for data detected by the content,
+// or nil if data is leap-seconds.list.
+func otherLeapSecondsParser(data []byte) func(io.Reader) (*LeapSecondsList, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("TZif")):
+		return ParseTZifLeapSeconds
+	case tzdataLeapLine.Match(data):
+		return ParseTZDataLeapSeconds
+	case bulletinCOffset.Match(data):
+		// leap-seconds.list also mentions Bulletin C in its comments,
+		// so look for the "UTC-TAI" lines.
+		return ParseBulletinC
+	}
+	return nil
+}
+
+// WriteTo writes l in the format of leap-seconds.list, which ParseLeapSecondsList parses.
+// The dates are written in NTP timestamps with human-readable comments,
+// followed by the "#$" update date, the "#@" expiration date and the "#h" hash.
+// It implements io.WriterTo.
+func (l *LeapSecondsList) WriteTo(w io.Writer) (int64, error) {
+	if len(l.LeapSeconds) == 0 {
+		return 0, errors.New("webntp: no leap seconds to write")
+	}
+	if l.UpdateAt.IsZero() || l.ExpireAt.IsZero() {
+		return 0, errors.New("webntp: the update date and the expiration date are required")
+	}
+	if !leapSecondsEpoch.Before(l.LeapSeconds[0].At) {
+		return 0, errors.New("webntp: leap seconds must be after 1 January 1972")
+	}
+
+	update := ntpSeconds(l.UpdateAt)
+	expire := ntpSeconds(l.ExpireAt)
+
+	// the lines of the leap seconds, including the definition line.
+	type line struct {
+		at   int64
+		leap int
+		date time.Time
+	}
+	lines := make([]line, 0, len(l.LeapSeconds)+1)
+	lines = append(lines, line{ntpSeconds(leapSecondsEpoch), l.LeapSeconds[0].Leap, leapSecondsEpoch})
+	for _, leap := range l.LeapSeconds {
+		lines = append(lines, line{ntpSeconds(leap.At), leap.Leap + leap.Step, leap.At})
+	}
+
+	// calculate the hash
+	h := sha1.New()
+	buf := make([]byte, 0, 32)
+	h.Write(strconv.AppendInt(buf[:0], update, 10))
+	h.Write(strconv.AppendInt(buf[:0], expire, 10))
+	for _, line := range lines {
+		h.Write(strconv.AppendInt(buf[:0], line.at, 10))
+		h.Write(strconv.AppendInt(buf[:0], int64(line.leap), 10))
+	}
+	hash := h.Sum(nil)
+
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	fmt.Fprintf(bw, "#\tLast Update of leap second values: %s\n", l.UpdateAt.UTC().Format("2 January 2006"))
+	fmt.Fprintf(bw, "#$\t%d\n", update)
+	fmt.Fprintf(bw, "#\n")
+	fmt.Fprintf(bw, "#\tFile expires on: %s\n", l.ExpireAt.UTC().Format("2 January 2006"))
+	fmt.Fprintf(bw, "#@\t%d\n", expire)
+	fmt.Fprintf(bw, "#\n")
+	for _, line := range lines {
+		fmt.Fprintf(bw, "%d\t%d\t# %s\n", line.at, line.leap, line.date.UTC().Format("2 Jan 2006"))
+	}
+	fmt.Fprintf(bw, "#\n")
+	fmt.Fprintf(bw, "#h\t%08x %08x %08x %08x %08x\n",
+		binary.BigEndian.Uint32(hash[0:]),
+		binary.BigEndian.Uint32(hash[4:]),
+		binary.BigEndian.Uint32(hash[8:]),
+		binary.BigEndian.Uint32(hash[12:]),
+		binary.BigEndian.Uint32(hash[16:]),
+	)
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ntpSeconds returns t in seconds since the NTP epoch.
+func ntpSeconds(t time.Time) int64 {
+	return t.Unix() + ntpEpochOffset
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
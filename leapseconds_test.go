@@ -0,0 +1,186 @@
+package webntp
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLeapSecondsList_WriteTo(t *testing.T) {
+	data, err := os.ReadFile("testdata/leap-seconds-2019-05-02.list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ParseLeapSecondsList(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	n, err := want.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("unexpected length: want %d, got %d", buf.Len(), n)
+	}
+	out := buf.String()
+
+	// the same data and hash as the original.
+	for _, line := range []string{
+		"#$\t3676924800\n",
+		"#@\t3786480000\n",
+		"2272060800\t10\t# 1 Jan 1972\n",
+		"2287785600\t11\t# 1 Jul 1972\n",
+		"3692217600\t37\t# 1 Jan 2017\n",
+		"#h\t83c68138 d3650221 07dbbbcd 11fcc859 ced1106a\n",
+		"#\tLast Update of leap second values: 8 July 2016\n",
+		"#\tFile expires on: 28 December 2019\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("missing line %q", line)
+		}
+	}
+
+	// round trip
+	got, err := ParseLeapSecondsList(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLeapSecondsList_WriteTo_Fixture(t *testing.T) {
+	date := func(s string) time.Time {
+		t.Helper()
+		tt, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tt
+	}
+
+	// a negative leap second in the future.
+	want := &LeapSecondsList{
+		LeapSeconds: []LeapSecond{
+			{At: date("1972-07-01"), Leap: 10, Step: 1},
+			{At: date("2030-07-01"), Leap: 11, Step: -1},
+		},
+		UpdateAt: date("2029-01-01"),
+		ExpireAt: date("2031-01-01"),
+	}
+	var buf bytes.Buffer
+	if _, err := want.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseLeapSecondsList(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLeapSecondsList_WriteTo_Invalid(t *testing.T) {
+	at := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := map[string]*LeapSecondsList{
+		"empty": {
+			UpdateAt: at,
+			ExpireAt: at,
+		},
+		"no dates": {
+			LeapSeconds: []LeapSecond{{At: at, Leap: 36, Step: 1}},
+		},
+		"before 1972": {
+			LeapSeconds: []LeapSecond{{At: leapSecondsEpoch, Leap: 10, Step: 1}},
+			UpdateAt:    at,
+			ExpireAt:    at,
+		},
+	}
+	for name, l := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := l.WriteTo(&bytes.Buffer{}); err == nil {
+				t.Error("want error, got nil")
+			}
+		})
+	}
+}
+
+func TestParseLeapSeconds(t *testing.T) {
+	want := ietfLeapSeconds(t)[26]
+	for _, name := range []string{
+		"testdata/leap-seconds-2019-05-02.list",
+		"testdata/leapseconds-2025b",
+		"testdata/right-UTC-2025b",
+		"testdata/bulletinc-52.txt",
+	} {
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			list, err := ParseLeapSeconds(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := list.LeapSeconds[len(list.LeapSeconds)-1]
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("last leap second mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// leap-seconds.list is verified.
+	_, err := ParseLeapSeconds(strings.NewReader("#$\t3676924800\n#@\t3786480000\n2272060800\t10\n2287785600\t11\n"))
+	var herr *LeapSecondsHashError
+	if !errors.As(err, &herr) {
+		t.Errorf("want LeapSecondsHashError, got %v", err)
+	}
+}
+
+func TestDefaultLeapSecondsList(t *testing.T) {
+	list := DefaultLeapSecondsList()
+	want := ietfLeapSeconds(t)
+	if diff := cmp.Diff(want, list.LeapSeconds[:len(want)]); diff != "" {
+		t.Errorf("leap seconds mismatch (-want +got):\n%s", diff)
+	}
+	if !list.newerThan(&LeapSecondsList{UpdateAt: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)}) {
+		t.Errorf("the embedded list is too old: %s", list.UpdateAt)
+	}
+
+	// the callers may modify the list.
+	list.LeapSeconds[0].Leap = 0
+	if DefaultLeapSecondsList().LeapSeconds[0].Leap != 10 {
+		t.Error("the embedded list is shared")
+	}
+}
+
+func TestLeapSecondsList_NewerThan(t *testing.T) {
+	date := func(year int) time.Time {
+		return time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		a, b LeapSecondsList
+		want bool
+	}{
+		{LeapSecondsList{UpdateAt: date(2017), ExpireAt: date(2018)}, LeapSecondsList{UpdateAt: date(2016), ExpireAt: date(2019)}, true},
+		{LeapSecondsList{UpdateAt: date(2016), ExpireAt: date(2019)}, LeapSecondsList{UpdateAt: date(2017), ExpireAt: date(2018)}, false},
+		{LeapSecondsList{UpdateAt: date(2016), ExpireAt: date(2019)}, LeapSecondsList{UpdateAt: date(2016), ExpireAt: date(2018)}, true},
+		{LeapSecondsList{UpdateAt: date(2016), ExpireAt: date(2018)}, LeapSecondsList{UpdateAt: date(2016), ExpireAt: date(2018)}, false},
+		{LeapSecondsList{}, LeapSecondsList{UpdateAt: date(2016), ExpireAt: date(2018)}, false},
+	}
+	for i, tc := range tests {
+		if got := tc.a.newerThan(&tc.b); got != tc.want {
+			t.Errorf("#%d: want %t, got %t", i, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package webntp
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LeapEventType is the type of LeapEvent.
+type LeapEventType int
+
+const (
+	// LeapEventAnnounced fires when LeapWatcher learns an upcoming leap second.
+	LeapEventAnnounced LeapEventType = iota + 1
+
+	// LeapEventSoon fires LeapEvent.Notice before the leap second.
+	LeapEventSoon
+
+	// LeapEventInserted fires at the beginning of an inserted leap second, 23:59:60.
+	LeapEventInserted
+
+	// LeapEventDeleted fires at the beginning of a deleted leap second, 23:59:59.
+	LeapEventDeleted
+
+	// LeapEventOver fires at the end of the leap second, i.e. midnight of the next day,
+	// when the new TAI - UTC takes effect.
+	LeapEventOver
+)
+
+func (t LeapEventType) String() string {
+	switch t {
+	case LeapEventAnnounced:
+		return "announced"
+	case LeapEventSoon:
+		return "soon"
+	case LeapEventInserted:
+		return "inserted"
+	case LeapEventDeleted:
+		return "deleted"
+	case LeapEventOver:
+		return "over"
+	}
+	return "unknown"
+}
+
+// LeapEvent is an event of LeapWatcher.
+type LeapEvent struct {
+	Type LeapEventType
+
+	// LeapSecond is the leap second of the event.
+	LeapSecond LeapSecond
+
+	// Notice is how long before the leap second LeapEventSoon fires.
+	// It is zero for the other types.
+	Notice time.Duration
+
+	// Time is the scheduled time of the event.
+	// For LeapEventAnnounced, it is the time LeapWatcher learned the leap second.
+	Time time.Time
+}
+
+// LeapWatcher fires events around upcoming leap seconds,
+// e.g. to pause batch jobs during leap seconds.
+// Give it the leap seconds by Update, or by Server.AddLeapWatcher to follow the list of the server,
+// and call Run.
+//
+// The leap second begins one second before LeapSecond.At, as LeapSecondsList.InLeapSecond does.
+// The events are fired in order by a single goroutine, and the events that were
+// already past when the leap second was learned are not fired.
+type LeapWatcher struct {
+	// Notices are the durations before leap seconds to fire LeapEventSoon, e.g. 24 hours and 1 minute.
+	Notices []time.Duration
+
+	// OnEvent is called for each event if not nil.
+	OnEvent func(LeapEvent)
+
+	// Events receives each event if not nil.
+	// Run blocks until the event is received.
+	Events chan<- LeapEvent
+
+	// Clock is the time source of the watcher.
+	// If nil, SystemClock is used.
+	// If the Clock has the method WaitUntil(time.Time) <-chan time.Time,
+	// which receives when the Clock reaches the time,
+	// the watcher waits with it instead of time.Timer, e.g. a fake clock in tests.
+	Clock Clock
+
+	mu      sync.Mutex
+	list    *LeapSecondsList
+	updated chan struct{}
+}
+
+// waitClock is a Clock that also waits, see LeapWatcher.Clock.
+type waitClock interface {
+	Clock
+	WaitUntil(t time.Time) <-chan time.Time
+}
+
+// Update replaces the leap seconds that w watches.
+// It is safe to call Update while Run is running.
+// The list must not be modified after the call.
+func (w *LeapWatcher) Update(list *LeapSecondsList) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.list = list
+	select {
+	case w.updatedChan() <- struct{}{}:
+	default:
+	}
+}
+
+// updatedChan returns the channel to notify the updates. w.mu must be held.
+func (w *LeapWatcher) updatedChan() chan struct{} {
+	if w.updated == nil {
+		w.updated = make(chan struct{}, 1)
+	}
+	return w.updated
+}
+
+func (w *LeapWatcher) current() (*LeapSecondsList, <-chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.list, w.updatedChan()
+}
+
+func (w *LeapWatcher) now() time.Time {
+	if w.Clock == nil {
+		return SystemClock.Now()
+	}
+	return w.Clock.Now()
+}
+
+// Run fires the events until ctx is canceled.
+// It always returns a non-nil error, ctx.Err().
+func (w *LeapWatcher) Run(ctx context.Context) error {
+	announced := make(map[time.Time]bool)
+	last := w.now()
+	for {
+		now := w.now()
+		list, updated := w.current()
+
+		var announces, events []LeapEvent
+		var next time.Time
+		if list != nil {
+			for _, leap := range list.LeapSeconds {
+				if !leap.At.After(last) {
+					// the leap second is over.
+					continue
+				}
+				if !announced[leap.At] {
+					announced[leap.At] = true
+					announces = append(announces, LeapEvent{Type: LeapEventAnnounced, LeapSecond: leap, Time: now})
+				}
+				for _, e := range w.schedule(leap) {
+					switch {
+					case !e.Time.After(last):
+					case !e.Time.After(now):
+						events = append(events, e)
+					case next.IsZero() || e.Time.Before(next):
+						next = e.Time
+					}
+				}
+			}
+		}
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].Time.Before(events[j].Time)
+		})
+		for _, e := range append(announces, events...) {
+			if err := w.fire(ctx, e); err != nil {
+				return err
+			}
+		}
+		last = now
+
+		if err := w.wait(ctx, next, updated); err != nil {
+			return err
+		}
+	}
+}
+
+// wait waits until next, or an update. If next is zero, it waits only for an update.
+func (w *LeapWatcher) wait(ctx context.Context, next time.Time, updated <-chan struct{}) error {
+	var timeout <-chan time.Time
+	if !next.IsZero() {
+		if c, ok := w.Clock.(waitClock); ok {
+			timeout = c.WaitUntil(next)
+		} else {
+			timer := time.NewTimer(next.Sub(w.now()))
+			defer timer.Stop()
+			timeout = timer.C
+		}
+	}
+	select {
+	case <-timeout:
+	case <-updated:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// schedule returns the events of leap except LeapEventAnnounced in order.
+func (w *LeapWatcher) schedule(leap LeapSecond) []LeapEvent {
+	begin := leap.At.Add(-time.Second)
+	events := make([]LeapEvent, 0, len(w.Notices)+2)
+	for _, notice := range w.Notices {
+		if notice <= 0 {
+			continue
+		}
+		events = append(events, LeapEvent{Type: LeapEventSoon, LeapSecond: leap, Notice: notice, Time: begin.Add(-notice)})
+	}
+	typ := LeapEventInserted
+	if leap.Step < 0 {
+		typ = LeapEventDeleted
+	}
+	events = append(events,
+		LeapEvent{Type: typ, LeapSecond: leap, Time: begin},
+		LeapEvent{Type: LeapEventOver, LeapSecond: leap, Time: leap.At},
+	)
+	return events
+}
+
+func (w *LeapWatcher) fire(ctx context.Context, e LeapEvent) error {
+	if w.OnEvent != nil {
+		w.OnEvent(e)
+	}
+	if w.Events != nil {
+		select {
+		case w.Events <- e:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
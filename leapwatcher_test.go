@@ -0,0 +1,266 @@
+package webntp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock advanced by the tests.
+// It implements WaitUntil for LeapWatcher.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) WaitUntil(t time.Time) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if !t.After(c.now) {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: t, ch: ch})
+	return ch
+}
+
+// Set sets the time, and wakes up the waiters.
+func (c *fakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.ch <- now
+	}
+	c.waiters = waiters
+}
+
+// startLeapWatcher runs w until the test ends, and returns the events of w.
+func startLeapWatcher(t *testing.T, w *LeapWatcher) <-chan LeapEvent {
+	t.Helper()
+	ch := make(chan LeapEvent)
+	w.Events = ch
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("want context.Canceled, got %v", err)
+		}
+	})
+	return ch
+}
+
+func expectLeapEvents(t *testing.T, ch <-chan LeapEvent, want ...LeapEvent) {
+	t.Helper()
+	for _, want := range want {
+		select {
+		case got := <-ch:
+			if got.Type != want.Type || got.Notice != want.Notice || !got.LeapSecond.At.Equal(want.LeapSecond.At) {
+				t.Fatalf("want %s event of %s (notice %s), got %s event of %s (notice %s)",
+					want.Type, want.LeapSecond.At, want.Notice, got.Type, got.LeapSecond.At, got.Notice)
+			}
+			if want.Type != LeapEventAnnounced && !got.Time.Equal(want.Time) {
+				t.Fatalf("%s: want time %s, got %s", want.Type, want.Time, got.Time)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %s event", want.Type)
+		}
+	}
+}
+
+func expectNoLeapEvent(t *testing.T, ch <-chan LeapEvent) {
+	t.Helper()
+	select {
+	case got := <-ch:
+		t.Fatalf("unexpected %s event of %s", got.Type, got.LeapSecond.At)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLeapWatcher(t *testing.T) {
+	leap := LeapSecond{At: time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC), Leap: 37, Step: 1}
+	begin := leap.At.Add(-time.Second)
+	clock := newFakeClock(leap.At.Add(-48 * time.Hour))
+	w := &LeapWatcher{
+		Notices: []time.Duration{24 * time.Hour, time.Minute},
+		Clock:   clock,
+	}
+	w.Update(&LeapSecondsList{LeapSeconds: []LeapSecond{leap}})
+	ch := startLeapWatcher(t, w)
+
+	expectLeapEvents(t, ch, LeapEvent{Type: LeapEventAnnounced, LeapSecond: leap})
+	expectNoLeapEvent(t, ch)
+
+	clock.Set(begin.Add(-24*time.Hour - time.Nanosecond))
+	expectNoLeapEvent(t, ch)
+	clock.Set(begin.Add(-24 * time.Hour))
+	expectLeapEvents(t, ch, LeapEvent{Type: LeapEventSoon, LeapSecond: leap, Notice: 24 * time.Hour, Time: begin.Add(-24 * time.Hour)})
+
+	clock.Set(begin.Add(-time.Minute))
+	expectLeapEvents(t, ch, LeapEvent{Type: LeapEventSoon, LeapSecond: leap, Notice: time.Minute, Time: begin.Add(-time.Minute)})
+
+	clock.Set(begin.Add(time.Second / 2))
+	expectLeapEvents(t, ch, LeapEvent{Type: LeapEventInserted, LeapSecond: leap, Time: begin})
+
+	clock.Set(leap.At)
+	expectLeapEvents(t, ch, LeapEvent{Type: LeapEventOver, LeapSecond: leap, Time: leap.At})
+
+	clock.Set(leap.At.Add(365 * 24 * time.Hour))
+	expectNoLeapEvent(t, ch)
+}
+
+func TestLeapWatcher_Late(t *testing.T) {
+	// the clock jumps over the leap second, e.g. suspended.
+	leap := LeapSecond{At: time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC), Leap: 37, Step: -1}
+	begin := leap.At.Add(-time.Second)
+	clock := newFakeClock(leap.At.Add(-48 * time.Hour))
+	w := &LeapWatcher{
+		Notices: []time.Duration{time.Hour},
+		Clock:   clock,
+	}
+	w.Update(&LeapSecondsList{LeapSeconds: []LeapSecond{leap}})
+	ch := startLeapWatcher(t, w)
+	expectLeapEvents(t, ch, LeapEvent{Type: LeapEventAnnounced, LeapSecond: leap})
+
+	clock.Set(leap.At.Add(time.Hour))
+	expectLeapEvents(t, ch,
+		LeapEvent{Type: LeapEventSoon, LeapSecond: leap, Notice: time.Hour, Time: begin.Add(-time.Hour)},
+		LeapEvent{Type: LeapEventDeleted, LeapSecond: leap, Time: begin},
+		LeapEvent{Type: LeapEventOver, LeapSecond: leap, Time: leap.At},
+	)
+}
+
+func TestLeapWatcher_Update(t *testing.T) {
+	past := LeapSecond{At: time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC), Leap: 36, Step: 1}
+	leap := LeapSecond{At: time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC), Leap: 37, Step: 1}
+	clock := newFakeClock(leap.At.Add(-30 * time.Minute))
+	w := &LeapWatcher{
+		Notices: []time.Duration{time.Hour, time.Minute},
+		Clock:   clock,
+	}
+	ch := startLeapWatcher(t, w)
+
+	// no upcoming leap seconds.
+	w.Update(&LeapSecondsList{LeapSeconds: []LeapSecond{past}})
+	expectNoLeapEvent(t, ch)
+
+	// a new leap second is announced, and the passed notice is skipped.
+	w.Update(&LeapSecondsList{LeapSeconds: []LeapSecond{past, leap}})
+	expectLeapEvents(t, ch, LeapEvent{Type: LeapEventAnnounced, LeapSecond: leap})
+	expectNoLeapEvent(t, ch)
+
+	// the same leap second is not announced again.
+	w.Update(&LeapSecondsList{LeapSeconds: []LeapSecond{past, leap}})
+	expectNoLeapEvent(t, ch)
+
+	clock.Set(leap.At.Add(-time.Second - time.Minute))
+	expectLeapEvents(t, ch, LeapEvent{Type: LeapEventSoon, LeapSecond: leap, Notice: time.Minute, Time: leap.At.Add(-time.Second - time.Minute)})
+}
+
+func TestLeapWatcher_Canceled(t *testing.T) {
+	w := &LeapWatcher{
+		Clock: newFakeClock(time.Now()),
+		// nobody receives the events.
+		Events: make(chan LeapEvent),
+	}
+	w.Update(&LeapSecondsList{LeapSeconds: []LeapSecond{{At: time.Now().Add(time.Hour), Leap: 37, Step: 1}}})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Run(ctx)
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("want context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestLeapWatcher_OnEvent(t *testing.T) {
+	leap := LeapSecond{At: time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC), Leap: 37, Step: 1}
+	clock := newFakeClock(leap.At.Add(-time.Hour))
+	var mu sync.Mutex
+	var got []LeapEventType
+	w := &LeapWatcher{
+		Clock: clock,
+		OnEvent: func(e LeapEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			got = append(got, e.Type)
+		},
+	}
+	w.Update(&LeapSecondsList{LeapSeconds: []LeapSecond{leap}})
+	ch := startLeapWatcher(t, w)
+	expectLeapEvents(t, ch, LeapEvent{Type: LeapEventAnnounced, LeapSecond: leap})
+	clock.Set(leap.At)
+	expectLeapEvents(t, ch,
+		LeapEvent{Type: LeapEventInserted, LeapSecond: leap, Time: leap.At.Add(-time.Second)},
+		LeapEvent{Type: LeapEventOver, LeapSecond: leap, Time: leap.At},
+	)
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []LeapEventType{LeapEventAnnounced, LeapEventInserted, LeapEventOver}
+	if len(got) != len(want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("#%d: want %s, got %s", i, want[i], got[i])
+		}
+	}
+}
+
+func TestServer_AddLeapWatcher(t *testing.T) {
+	s := &Server{}
+	s.Start()
+	defer s.Close()
+
+	// the embedded list has no upcoming leap seconds until 2030.
+	clock := newFakeClock(time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC))
+	w := &LeapWatcher{Clock: clock}
+	s.AddLeapWatcher(w)
+	ch := startLeapWatcher(t, w)
+	expectNoLeapEvent(t, ch)
+
+	// the server gets a new leap second.
+	list := DefaultLeapSecondsList()
+	leap := LeapSecond{At: time.Date(2030, time.July, 1, 0, 0, 0, 0, time.UTC), Leap: 37, Step: 1}
+	list.LeapSeconds = append(list.LeapSeconds, leap)
+	list.UpdateAt = time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	list.ExpireAt = time.Date(2030, time.December, 28, 0, 0, 0, 0, time.UTC)
+	s.setLeapSecondsList(list, "test", nil, time.Now())
+	expectLeapEvents(t, ch, LeapEvent{Type: LeapEventAnnounced, LeapSecond: leap})
+}
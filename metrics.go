@@ -0,0 +1,171 @@
+package webntp
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// protocol is a protocol served by the Server.
+type protocol int
+
+const (
+	protocolJSON protocol = iota
+	protocolWebSocket
+	protocolHTTPSTime
+	protocolWebSocketNTP
+	protocolNTPOverHTTP
+	protocolNTP
+	protocolRoughtime
+	numProtocols
+)
+
+func (p protocol) String() string {
+	switch p {
+	case protocolJSON:
+		return "json"
+	case protocolWebSocket:
+		return "websocket"
+	case protocolHTTPSTime:
+		return "https_time"
+	case protocolWebSocketNTP:
+		return "websocket_ntp"
+	case protocolNTPOverHTTP:
+		return "ntp_http"
+	case protocolNTP:
+		return "ntp"
+	case protocolRoughtime:
+		return "roughtime"
+	}
+	return "unknown"
+}
+
+// latencyBuckets is the upper bounds of the latency histograms.
+var latencyBuckets = [...]time.Duration{
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// histogram is a lock-free latency histogram.
+type histogram struct {
+	// counts[i] is the number of observations in (latencyBuckets[i-1], latencyBuckets[i]].
+	// the last element is for +Inf.
+	counts [len(latencyBuckets) + 1]atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Int64 // in nanoseconds
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(latencyBuckets) && d > latencyBuckets[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+	h.count.Add(1)
+}
+
+// serverMetrics is the metrics of the Server.
+type serverMetrics struct {
+	requests  [numProtocols]atomic.Uint64
+	durations [numProtocols]histogram
+
+	websocketConnections atomic.Int64
+
+	rejectedRateLimit atomic.Uint64
+	rejectedOverload  atomic.Uint64
+
+	leapSecondsFetchSuccess atomic.Uint64
+	leapSecondsFetchFailure atomic.Uint64
+}
+
+func (m *serverMetrics) observe(p protocol, start time.Time) {
+	m.requests[p].Add(1)
+	m.durations[p].observe(time.Since(start))
+}
+
+// MetricsHandler returns a handler that exposes the metrics of the server
+// in the Prometheus text exposition format.
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var buf bytes.Buffer
+		s.writeMetrics(&buf)
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		rw.Header().Set("Cache-Control", "no-cache, no-store")
+		rw.Write(buf.Bytes())
+	})
+}
+
+func (s *Server) writeMetrics(buf *bytes.Buffer) {
+	m := &s.metrics
+
+	writeHeader(buf, "webntp_requests_total", "counter", "Total number of time requests served, by protocol.")
+	for p := protocol(0); p < numProtocols; p++ {
+		fmt.Fprintf(buf, "webntp_requests_total{protocol=%q} %d\n", p.String(), m.requests[p].Load())
+	}
+
+	writeHeader(buf, "webntp_request_duration_seconds", "histogram", "Latency of time requests, by protocol.")
+	for p := protocol(0); p < numProtocols; p++ {
+		h := &m.durations[p]
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			cumulative += h.counts[i].Load()
+			fmt.Fprintf(buf, "webntp_request_duration_seconds_bucket{protocol=%q,le=%q} %d\n", p.String(), formatFloat(le.Seconds()), cumulative)
+		}
+		cumulative += h.counts[len(latencyBuckets)].Load()
+		fmt.Fprintf(buf, "webntp_request_duration_seconds_bucket{protocol=%q,le=\"+Inf\"} %d\n", p.String(), cumulative)
+		fmt.Fprintf(buf, "webntp_request_duration_seconds_sum{protocol=%q} %s\n", p.String(), formatFloat(time.Duration(h.sum.Load()).Seconds()))
+		fmt.Fprintf(buf, "webntp_request_duration_seconds_count{protocol=%q} %d\n", p.String(), h.count.Load())
+	}
+
+	writeHeader(buf, "webntp_websocket_connections", "gauge", "Number of open WebSocket connections.")
+	fmt.Fprintf(buf, "webntp_websocket_connections %d\n", m.websocketConnections.Load())
+
+	writeHeader(buf, "webntp_rejected_requests_total", "counter", "Total number of rejected requests and WebSocket messages, by reason.")
+	fmt.Fprintf(buf, "webntp_rejected_requests_total{reason=\"rate_limit\"} %d\n", m.rejectedRateLimit.Load())
+	fmt.Fprintf(buf, "webntp_rejected_requests_total{reason=\"overload\"} %d\n", m.rejectedOverload.Load())
+
+	writeHeader(buf, "webntp_leap_seconds_fetch_total", "counter", "Total number of leap-seconds.list fetches, by result.")
+	fmt.Fprintf(buf, "webntp_leap_seconds_fetch_total{result=\"success\"} %d\n", m.leapSecondsFetchSuccess.Load())
+	fmt.Fprintf(buf, "webntp_leap_seconds_fetch_total{result=\"failure\"} %d\n", m.leapSecondsFetchFailure.Load())
+
+	if list, ok := s.leapSecondsList.Load().(*LeapSecondsList); ok {
+		writeHeader(buf, "webntp_leap_seconds_info", "gauge", "Source of the active leap-seconds.list.")
+		fmt.Fprintf(buf, "webntp_leap_seconds_info{source=%q} 1\n", s.LeapSecondsSource())
+		// TZif files have neither of the dates.
+		if !list.UpdateAt.IsZero() {
+			writeHeader(buf, "webntp_leap_seconds_update_timestamp_seconds", "gauge", "Last update time of the leap-seconds.list in unix time.")
+			fmt.Fprintf(buf, "webntp_leap_seconds_update_timestamp_seconds %d\n", list.UpdateAt.Unix())
+		}
+		if !list.ExpireAt.IsZero() {
+			writeHeader(buf, "webntp_leap_seconds_expire_timestamp_seconds", "gauge", "Expiration time of the leap-seconds.list in unix time.")
+			fmt.Fprintf(buf, "webntp_leap_seconds_expire_timestamp_seconds %d\n", list.ExpireAt.Unix())
+			writeHeader(buf, "webntp_leap_seconds_expires_in_seconds", "gauge", "Seconds until the leap-seconds.list expires. Negative if it has already expired.")
+			fmt.Fprintf(buf, "webntp_leap_seconds_expires_in_seconds %s\n", formatFloat(list.ExpireAt.Sub(s.now()).Seconds()))
+		}
+	}
+}
+
+func writeHeader(buf *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, typ)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
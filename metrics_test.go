@@ -0,0 +1,71 @@
+package webntp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_MetricsHandler(t *testing.T) {
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Unix(1234567891, 0)
+		}),
+		LeapSecondsPath: "testdata/leap-seconds-2019-05-02.list",
+	}
+	s.Start()
+	defer s.Close()
+
+	// send some requests
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/?1234567890", nil))
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/?1234567890", nil))
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodHead, "http://example.com/.well-known/time", nil))
+
+	w := httptest.NewRecorder()
+	s.MetricsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://example.com/metrics", nil))
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type: %s", got)
+	}
+
+	body := w.Body.String()
+	wants := []string{
+		`# TYPE webntp_requests_total counter`,
+		`webntp_requests_total{protocol="json"} 2`,
+		`webntp_requests_total{protocol="websocket"} 0`,
+		`webntp_requests_total{protocol="https_time"} 1`,
+		`webntp_request_duration_seconds_bucket{protocol="json",le="+Inf"} 2`,
+		`webntp_request_duration_seconds_count{protocol="https_time"} 1`,
+		`webntp_websocket_connections 0`,
+		`webntp_leap_seconds_fetch_total{result="success"} 0`,
+		// the file is used even if it is older than the embedded list, because the server never fetches.
+		`webntp_leap_seconds_info{source="testdata/leap-seconds-2019-05-02.list"} 1`,
+		`webntp_leap_seconds_expire_timestamp_seconds 1577491200`,
+	}
+	for _, want := range wants {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metrics should contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestHistogram_Observe(t *testing.T) {
+	var h histogram
+	h.observe(10 * time.Microsecond)
+	h.observe(time.Millisecond)
+	h.observe(time.Minute)
+
+	if got := h.counts[0].Load(); got != 1 {
+		t.Errorf("want 1, got %d", got)
+	}
+	if got := h.counts[4].Load(); got != 1 {
+		t.Errorf("want 1, got %d", got)
+	}
+	if got := h.counts[len(latencyBuckets)].Load(); got != 1 {
+		t.Errorf("want 1, got %d", got)
+	}
+	if got := h.count.Load(); got != 3 {
+		t.Errorf("want 3, got %d", got)
+	}
+}
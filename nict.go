@@ -0,0 +1,112 @@
+package webntp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NICT compatible paths.
+// https://jjy.nict.go.jp/QandA/reference/http-archive.html
+const (
+	// NICTJSONPath is the path that returns JSON.
+	NICTJSONPath = "/cgi-bin/json"
+
+	// NICTJSONPPath is the path that returns JSONP.
+	// The default callback name is "jsont".
+	NICTJSONPPath = "/cgi-bin/jsont"
+)
+
+const defaultNICTCallback = "jsont"
+
+var errInvalidCallback = errors.New("webntp: invalid callback name")
+
+// jsonQuery is the query of JSON over HTTP requests.
+type jsonQuery struct {
+	it       Timestamp
+	callback string
+	nonce    string
+}
+
+// parseJSONQuery parses the query of JSON over HTTP requests.
+// The query is either a bare timestamp (e.g. "?1234567890.123")
+// or named parameters (e.g. "?it=1234567890.123&callback=fn&nonce=abc").
+func parseJSONQuery(rawQuery string) (jsonQuery, error) {
+	q := jsonQuery{it: zeroEpochTime}
+	for _, part := range strings.Split(rawQuery, "&") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			// bare timestamp
+			key, value = "it", key
+		}
+		value, err := url.QueryUnescape(value)
+		if err != nil {
+			return jsonQuery{}, err
+		}
+		switch key {
+		case "it":
+			if err := q.it.UnmarshalJSON([]byte(strings.TrimSpace(value))); err != nil {
+				return jsonQuery{}, err
+			}
+		case "callback":
+			if !validCallback(value) {
+				return jsonQuery{}, errInvalidCallback
+			}
+			q.callback = value
+		case "nonce":
+			if !validNonce(value) {
+				return jsonQuery{}, errInvalidNonce
+			}
+			q.nonce = value
+		}
+	}
+	return q, nil
+}
+
+// validCallback reports whether name is safe as a JSONP callback.
+// It accepts JavaScript identifiers joined by dots, e.g. "jsont" or "htptime.callback".
+func validCallback(name string) bool {
+	if name == "" || len(name) > 128 {
+		return false
+	}
+	for _, ident := range strings.Split(name, ".") {
+		if ident == "" {
+			return false
+		}
+		for i, c := range ident {
+			switch {
+			case c == '_' || c == '$':
+			case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+			case '0' <= c && c <= '9' && i > 0:
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// writeJSONP writes res as JSONP.
+func writeJSONP(rw http.ResponseWriter, callback string, res *Response) {
+	b, err := json.Marshal(res)
+	if err != nil {
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	buf := make([]byte, 0, len(callback)+len(b)+4)
+	buf = append(buf, callback...)
+	buf = append(buf, '(')
+	buf = append(buf, b...)
+	buf = append(buf, ");\n"...)
+
+	rw.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.Header().Set("Cache-Control", "no-cache, no-store")
+	rw.Write(buf)
+}
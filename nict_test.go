@@ -0,0 +1,122 @@
+package webntp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJSONQuery(t *testing.T) {
+	testCases := []struct {
+		query    string
+		it       string
+		callback string
+		nonce    string
+		err      bool
+	}{
+		{"", "0.000000", "", "", false},
+		{"1234567890.123", "1234567890.123000", "", "", false},
+		{"it=1234567890.123", "1234567890.123000", "", "", false},
+		{"it=1234567890.123&callback=fn", "1234567890.123000", "fn", "", false},
+		{"callback=htptime.cb&it=1234567890", "1234567890.000000", "htptime.cb", "", false},
+		{"1234567890&callback=fn", "1234567890.000000", "fn", "", false},
+		{"callback=fn&_=1489217288328", "0.000000", "fn", "", false},
+		{"callback=alert(1)", "", "", "", true},
+		{"callback=1fn", "", "", "", true},
+		{"callback=fn.", "", "", "", true},
+		{"it=foo", "", "", "", true},
+		{"it=1234567890&nonce=abc-_%2B%2F%3D", "1234567890.000000", "", "abc-_+/=", false},
+		{"nonce=a%0Ab", "", "", "", true},
+	}
+	for _, tc := range testCases {
+		q, err := parseJSONQuery(tc.query)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%q: want error, got nil", tc.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tc.query, err)
+			continue
+		}
+		b, _ := q.it.MarshalJSON()
+		if string(b) != tc.it {
+			t.Errorf("%q: unexpected it: want %s, got %s", tc.query, tc.it, b)
+		}
+		if q.callback != tc.callback {
+			t.Errorf("%q: unexpected callback: want %q, got %q", tc.query, tc.callback, q.callback)
+		}
+		if q.nonce != tc.nonce {
+			t.Errorf("%q: unexpected nonce: want %q, got %q", tc.query, tc.nonce, q.nonce)
+		}
+	}
+}
+
+func TestServer_NICTCompatible(t *testing.T) {
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Unix(1234567891, 0)
+		}),
+		NICTCompatible: true,
+	}
+	s.Start()
+	defer s.Close()
+	h := s.Router("/api")
+
+	t.Run("JSONP", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/api?it=1234567890&callback=fn", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: want %d, got %d", http.StatusOK, w.Code)
+		}
+		if got := w.Header().Get("Content-Type"); got != "text/javascript; charset=utf-8" {
+			t.Errorf("unexpected Content-Type: %q", got)
+		}
+		body := w.Body.String()
+		if !strings.HasPrefix(body, "fn(") || !strings.HasSuffix(body, ");\n") {
+			t.Fatalf("unexpected body: %q", body)
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal([]byte(body[len("fn("):len(body)-len(");\n")]), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got["it"] != 1234567890.0 {
+			t.Errorf("unexpected it: %v", got["it"])
+		}
+		if got["st"] != 1234567891.0 {
+			t.Errorf("unexpected st: %v", got["st"])
+		}
+	})
+
+	t.Run("/cgi-bin/jsont", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/cgi-bin/jsont?1234567890", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if body := w.Body.String(); !strings.HasPrefix(body, "jsont(") {
+			t.Errorf("unexpected body: %q", body)
+		}
+	})
+
+	t.Run("/cgi-bin/json", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/cgi-bin/json?1234567890", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if got := w.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+			t.Errorf("unexpected Content-Type: %q", got)
+		}
+	})
+
+	t.Run("invalid callback", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/api?callback=alert(1)", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("unexpected status code: want %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+}
@@ -0,0 +1,346 @@
+package webntp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// SubprotocolNTP is a subprotocol name for websocket.
+// The messages are binary frames of NTP packets defined in RFC 5905,
+// and the responses from the server are followed by the leap second extension field.
+const SubprotocolNTP = "ntp.webntp.shogo82148.com"
+
+// ntpPacketSize is the size of NTP packets without extension fields.
+const ntpPacketSize = 48
+
+// NTP leap indicators.
+const (
+	ntpLeapNoWarning uint8 = 0
+	ntpLeapAddSecond uint8 = 1
+	ntpLeapDelSecond uint8 = 2
+	ntpLeapNotInSync uint8 = 3
+)
+
+// NTP modes.
+const (
+	ntpModeClient uint8 = 3
+	ntpModeServer uint8 = 4
+)
+
+const ntpVersion = 4
+
+// the default values of the server packets.
+// The server serves the system clock, which is not a reference clock,
+// so the stratum is that of an undisciplined local clock ("local stratum 10" of chrony),
+// and the root dispersion is a typical error of the system clock synchronized over the network.
+const (
+	defaultStratum        = 10
+	defaultPrecision      = -20 // about 1 microsecond
+	defaultReferenceID    = "WNTP"
+	defaultRootDispersion = 10 * time.Millisecond
+)
+
+var errNTPPacketTooShort = errors.New("webntp: ntp packet is too short")
+
+// ntpTime is the NTP timestamp format. RFC 5905 Section 6.
+// The upper 32 bits are seconds since 1900-01-01 and the lower 32 bits are the fraction.
+type ntpTime uint64
+
+// ntpEra1 is the offset between era 0 and era 1 in seconds.
+const ntpEra1 = 1 << 32
+
+func toNTPTime(t time.Time) ntpTime {
+	if t.IsZero() {
+		return 0
+	}
+	sec := t.Unix() + ntpEpochOffset
+	frac := (uint64(t.Nanosecond())<<32 + 5e8) / 1e9
+	return ntpTime(uint64(sec)<<32 + frac)
+}
+
+// Time converts t to time.Time.
+// The timestamps whose most significant bit is 0 are in era 1 (2036-2104). RFC 4330 Section 3.
+func (t ntpTime) Time() time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	sec := int64(t >> 32)
+	if sec < 1<<31 {
+		sec += ntpEra1
+	}
+	nsec := (uint64(t&0xffffffff)*1e9 + 1<<31) >> 32
+	return time.Unix(sec-ntpEpochOffset, int64(nsec))
+}
+
+// ntpShort is the NTP short format. RFC 5905 Section 6.
+// The upper 16 bits are seconds and the lower 16 bits are the fraction.
+type ntpShort uint32
+
+func toNTPShort(d time.Duration) ntpShort {
+	if d < 0 {
+		return 0
+	}
+	return ntpShort(uint64(d) << 16 / uint64(time.Second))
+}
+
+func (s ntpShort) Duration() time.Duration {
+	return time.Duration(uint64(s) * uint64(time.Second) >> 16)
+}
+
+// ntpPacket is an NTP packet. RFC 5905 Section 7.3.
+type ntpPacket struct {
+	Leap           uint8
+	Version        uint8
+	Mode           uint8
+	Stratum        uint8
+	Poll           int8
+	Precision      int8
+	RootDelay      ntpShort
+	RootDispersion ntpShort
+	ReferenceID    [4]byte
+	ReferenceTime  ntpTime
+	OriginTime     ntpTime
+	ReceiveTime    ntpTime
+	TransmitTime   ntpTime
+}
+
+func (p *ntpPacket) appendBinary(b []byte) []byte {
+	b = append(b, p.Leap<<6|(p.Version&0x07)<<3|p.Mode&0x07, p.Stratum, byte(p.Poll), byte(p.Precision))
+	b = binary.BigEndian.AppendUint32(b, uint32(p.RootDelay))
+	b = binary.BigEndian.AppendUint32(b, uint32(p.RootDispersion))
+	b = append(b, p.ReferenceID[:]...)
+	b = binary.BigEndian.AppendUint64(b, uint64(p.ReferenceTime))
+	b = binary.BigEndian.AppendUint64(b, uint64(p.OriginTime))
+	b = binary.BigEndian.AppendUint64(b, uint64(p.ReceiveTime))
+	b = binary.BigEndian.AppendUint64(b, uint64(p.TransmitTime))
+	return b
+}
+
+// MarshalBinary encodes p into the wire format.
+func (p *ntpPacket) MarshalBinary() ([]byte, error) {
+	return p.appendBinary(make([]byte, 0, ntpPacketSize)), nil
+}
+
+// UnmarshalBinary decodes the wire format.
+// Extension fields and MAC following the header are ignored.
+func (p *ntpPacket) UnmarshalBinary(b []byte) error {
+	if len(b) < ntpPacketSize {
+		return errNTPPacketTooShort
+	}
+	p.Leap = b[0] >> 6
+	p.Version = (b[0] >> 3) & 0x07
+	p.Mode = b[0] & 0x07
+	p.Stratum = b[1]
+	p.Poll = int8(b[2])
+	p.Precision = int8(b[3])
+	p.RootDelay = ntpShort(binary.BigEndian.Uint32(b[4:]))
+	p.RootDispersion = ntpShort(binary.BigEndian.Uint32(b[8:]))
+	copy(p.ReferenceID[:], b[12:16])
+	p.ReferenceTime = ntpTime(binary.BigEndian.Uint64(b[16:]))
+	p.OriginTime = ntpTime(binary.BigEndian.Uint64(b[24:]))
+	p.ReceiveTime = ntpTime(binary.BigEndian.Uint64(b[32:]))
+	p.TransmitTime = ntpTime(binary.BigEndian.Uint64(b[40:]))
+	return nil
+}
+
+// ntpLeapExtensionType is the field type of the leap second extension field.
+// It is in the range for experimental use.
+const ntpLeapExtensionType = 0xf5e0
+
+// ntpLeapExtensionSize is the size of the leap second extension field.
+const ntpLeapExtensionSize = 16
+
+// ntpLeapExtensionStale is the flag of the leap second extension field
+// that the leap seconds list of the server is expired or missing.
+const ntpLeapExtensionStale = 0x01
+
+// ntpLeapExtension is an extension field (RFC 7822) that carries the leap second information,
+// which the NTP leap indicator cannot express.
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-------------------------------+-------------------------------+
+//	|      Field Type (0xf5e0)      |          Length (16)          |
+//	+-------------------------------+---------------+---------------+
+//	|       TAI - UTC (before Next) |     Step      |     Flags     |
+//	+-------------------------------+---------------+---------------+
+//	|                                                               |
+//	+          Next or last leap second (NTP timestamp)             +
+//	|                                                               |
+//	+---------------------------------------------------------------+
+//
+// The flag 0x01 of Flags is ntpLeapExtensionStale, and the others are reserved.
+type ntpLeapExtension struct {
+	Leap  int16
+	Step  int8
+	Stale bool
+	Next  ntpTime
+}
+
+func (e *ntpLeapExtension) appendBinary(b []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, ntpLeapExtensionType)
+	b = binary.BigEndian.AppendUint16(b, ntpLeapExtensionSize)
+	b = binary.BigEndian.AppendUint16(b, uint16(e.Leap))
+	var flags byte
+	if e.Stale {
+		flags |= ntpLeapExtensionStale
+	}
+	b = append(b, byte(e.Step), flags)
+	b = binary.BigEndian.AppendUint64(b, uint64(e.Next))
+	return b
+}
+
+// findNTPLeapExtension finds the leap second extension field in the extension fields b.
+func findNTPLeapExtension(b []byte) (ntpLeapExtension, bool) {
+	for len(b) >= 4 {
+		typ := binary.BigEndian.Uint16(b)
+		length := int(binary.BigEndian.Uint16(b[2:]))
+		if length < 4 || length > len(b) {
+			break
+		}
+		if typ == ntpLeapExtensionType && length >= ntpLeapExtensionSize {
+			return ntpLeapExtension{
+				Leap:  int16(binary.BigEndian.Uint16(b[4:])),
+				Step:  int8(b[6]),
+				Stale: b[7]&ntpLeapExtensionStale != 0,
+				Next:  ntpTime(binary.BigEndian.Uint64(b[8:])),
+			}, true
+		}
+		b = b[length:]
+	}
+	return ntpLeapExtension{}, false
+}
+
+// ntpLeapIndicator returns the leap indicator for leap at now.
+// It warns the leap second in the last 24 hours before the event.
+func ntpLeapIndicator(leap LeapSecond, now time.Time) uint8 {
+	d := leap.At.Sub(now)
+	if d <= 0 || d > 24*time.Hour {
+		return ntpLeapNoWarning
+	}
+	switch {
+	case leap.Step > 0:
+		return ntpLeapAddSecond
+	case leap.Step < 0:
+		return ntpLeapDelSecond
+	}
+	return ntpLeapNoWarning
+}
+
+// ntpResponse makes the response packet to req.
+// recv is the time when req is received, now is the time to send the response,
+// and leap is the leap second at now.
+// The leap indicator is the alarm condition if the leap seconds list is stale,
+// because the server can't tell the upcoming leap seconds.
+func (s *Server) ntpResponse(req *ntpPacket, recv, now time.Time, leap LeapSecond) *ntpPacket {
+	version := req.Version
+	if version == 0 || version > ntpVersion {
+		version = ntpVersion
+	}
+	li := ntpLeapIndicator(leap, now)
+	if s.leapSecondsStale(now) {
+		li = ntpLeapNotInSync
+	}
+	return &ntpPacket{
+		Leap:           li,
+		Version:        version,
+		Mode:           ntpModeServer,
+		Stratum:        s.stratum(),
+		Poll:           req.Poll,
+		Precision:      defaultPrecision,
+		RootDispersion: toNTPShort(defaultRootDispersion),
+		ReferenceID:    s.referenceID(),
+		ReferenceTime:  toNTPTime(recv),
+		OriginTime:     req.TransmitTime,
+		ReceiveTime:    toNTPTime(recv),
+		TransmitTime:   toNTPTime(now),
+	}
+}
+
+func (s *Server) stratum() uint8 {
+	if s.Stratum == 0 {
+		return defaultStratum
+	}
+	return s.Stratum
+}
+
+func (s *Server) referenceID() [4]byte {
+	var id [4]byte
+	if s.ReferenceID == "" {
+		copy(id[:], defaultReferenceID)
+	} else {
+		copy(id[:], s.ReferenceID)
+	}
+	return id
+}
+
+// ntpLeapExtension returns the leap second extension field of leap at now.
+func (s *Server) ntpLeapExtension(leap LeapSecond, now time.Time) *ntpLeapExtension {
+	return &ntpLeapExtension{
+		Leap:  int16(leap.Leap),
+		Step:  int8(leap.Step),
+		Stale: s.leapSecondsStale(now),
+		Next:  toNTPTime(leap.At),
+	}
+}
+
+// KissOfDeathError is the error returned when an NTP server responds with a Kiss-o'-Death packet.
+// RFC 5905 Section 7.4.
+type KissOfDeathError struct {
+	// Code is the kiss code, e.g. "RATE" or "DENY".
+	Code string
+}
+
+func (e *KissOfDeathError) Error() string {
+	return "webntp: kiss-o'-death: " + e.Code
+}
+
+var errUnexpectedNTPResponse = errors.New("webntp: unexpected ntp response")
+
+// ntpResult calculates the result from the response.
+// origin is the transmit timestamp in the request.
+// start is the time when the request is sent, and end is the time when the response is received.
+// ext is the leap second extension field in the response, or nil.
+func ntpResult(res *ntpPacket, ext *ntpLeapExtension, origin ntpTime, start, end time.Time) (Result, error) {
+	if res.Mode != ntpModeServer || res.OriginTime != origin {
+		return Result{}, errUnexpectedNTPResponse
+	}
+	if res.Stratum == 0 {
+		return Result{}, &KissOfDeathError{Code: string(bytes.TrimRight(res.ReferenceID[:], "\x00"))}
+	}
+	if res.Leap == ntpLeapNotInSync && (ext == nil || !ext.Stale) {
+		// the alarm only because of the stale leap seconds list is reported as Result.Stale.
+		return Result{}, errors.New("webntp: the server is not synchronized")
+	}
+
+	// RFC 5905 Section 8.
+	t1, t2, t3, t4 := start, res.ReceiveTime.Time(), res.TransmitTime.Time(), end
+	offset := (t2.Sub(t1) + t3.Sub(t4)) / 2
+	delay := t4.Sub(t1) - t3.Sub(t2)
+
+	result := Result{
+		Delay:  delay,
+		Offset: offset,
+	}
+	if ext != nil {
+		result.NextLeap = ext.Next.Time()
+		result.TAIOffset = time.Duration(ext.Leap) * time.Second
+		result.Step = int(ext.Step)
+		result.Stale = ext.Stale
+		return result, nil
+	}
+
+	// the leap indicator tells only that the last minute of the current day has 59 or 61 seconds.
+	switch res.Leap {
+	case ntpLeapAddSecond:
+		result.Step = 1
+	case ntpLeapDelSecond:
+		result.Step = -1
+	default:
+		return result, nil
+	}
+	result.NextLeap = t3.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	return result, nil
+}
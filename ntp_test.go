@@ -0,0 +1,269 @@
+package webntp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestNTPTime(t *testing.T) {
+	testCases := []struct {
+		t    string
+		want ntpTime
+	}{
+		{"1900-01-01T00:00:00.5Z", 0x0000000080000000},
+		{"1970-01-01T00:00:00Z", 0x83aa7e8000000000},
+		{"2017-01-01T00:00:00Z", 0xdc12c50000000000},
+		{"2017-01-01T00:00:00.25Z", 0xdc12c50040000000},
+		{"2036-02-07T06:28:16Z", 0x0000000000000000}, // the beginning of era 1
+		{"2036-02-07T06:28:17Z", 0x0000000100000000},
+	}
+	for _, tc := range testCases {
+		tt, err := time.Parse(time.RFC3339Nano, tc.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := toNTPTime(tt)
+		if got != tc.want {
+			t.Errorf("%s: want %#016x, got %#016x", tc.t, uint64(tc.want), uint64(got))
+		}
+		if tc.want == 0 || tt.Year() == 1900 {
+			// zero means unknown, and 1900 is ambiguous with era 1.
+			continue
+		}
+		if back := got.Time(); !back.Equal(tt) {
+			t.Errorf("%s: round trip failed: got %s", tc.t, back)
+		}
+	}
+}
+
+func TestNTPTime_Nanosecond(t *testing.T) {
+	tt := time.Unix(1234567890, 123456789)
+	if got := toNTPTime(tt).Time(); !got.Equal(tt) {
+		t.Errorf("want %s, got %s", tt, got)
+	}
+}
+
+func TestNTPShort(t *testing.T) {
+	if got := toNTPShort(1500 * time.Millisecond); got != 0x00018000 {
+		t.Errorf("want %#08x, got %#08x", 0x00018000, uint32(got))
+	}
+	if got := ntpShort(0x00018000).Duration(); got != 1500*time.Millisecond {
+		t.Errorf("want %s, got %s", 1500*time.Millisecond, got)
+	}
+}
+
+func TestNTPPacket_MarshalBinary(t *testing.T) {
+	p := &ntpPacket{
+		Leap:           ntpLeapAddSecond,
+		Version:        4,
+		Mode:           ntpModeServer,
+		Stratum:        2,
+		Poll:           6,
+		Precision:      -20,
+		RootDelay:      0x00010002,
+		RootDispersion: 0x00030004,
+		ReferenceID:    [4]byte{'G', 'P', 'S', 0},
+		ReferenceTime:  1,
+		OriginTime:     2,
+		ReceiveTime:    3,
+		TransmitTime:   4,
+	}
+	b, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != ntpPacketSize {
+		t.Fatalf("unexpected length: %d", len(b))
+	}
+	if b[0] != 0x64 { // 01 100 100
+		t.Errorf("unexpected first byte: %#02x", b[0])
+	}
+
+	var got ntpPacket
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if got != *p {
+		t.Errorf("want %#v, got %#v", *p, got)
+	}
+
+	if err := got.UnmarshalBinary(b[:ntpPacketSize-1]); err != errNTPPacketTooShort {
+		t.Errorf("want %v, got %v", errNTPPacketTooShort, err)
+	}
+}
+
+func TestNTPLeapExtension(t *testing.T) {
+	next, _ := time.Parse(time.RFC3339, "2017-01-01T00:00:00Z")
+	ext := &ntpLeapExtension{Leap: 36, Step: 1, Stale: true, Next: toNTPTime(next)}
+
+	// an unknown extension field is followed by the leap second extension.
+	b := []byte{0x00, 0x01, 0x00, 0x08, 0, 0, 0, 0}
+	b = ext.appendBinary(b)
+	got, ok := findNTPLeapExtension(b)
+	if !ok {
+		t.Fatal("the leap second extension is not found")
+	}
+	if got != *ext {
+		t.Errorf("want %#v, got %#v", *ext, got)
+	}
+
+	if _, ok := findNTPLeapExtension(b[:len(b)-1]); ok {
+		t.Error("want not found in the truncated fields")
+	}
+}
+
+func TestNTPLeapIndicator(t *testing.T) {
+	at, _ := time.Parse(time.RFC3339, "2017-01-01T00:00:00Z")
+	testCases := []struct {
+		leap LeapSecond
+		now  time.Time
+		want uint8
+	}{
+		{LeapSecond{At: at, Step: 1}, at.Add(-25 * time.Hour), ntpLeapNoWarning},
+		{LeapSecond{At: at, Step: 1}, at.Add(-time.Hour), ntpLeapAddSecond},
+		{LeapSecond{At: at, Step: -1}, at.Add(-time.Hour), ntpLeapDelSecond},
+		{LeapSecond{At: at, Step: 1}, at, ntpLeapNoWarning},
+	}
+	for _, tc := range testCases {
+		if got := ntpLeapIndicator(tc.leap, tc.now); got != tc.want {
+			t.Errorf("%s: want %d, got %d", tc.now, tc.want, got)
+		}
+	}
+}
+
+func TestServer_WebSocketNTP(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2016-12-31T23:59:59Z")
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return now
+		}),
+		LeapSecondsPath: "testdata/leap-seconds-2019-05-02.list",
+	}
+	s.Start()
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	conn, _, err := DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if got := conn.Subprotocol(); got != SubprotocolNTP {
+		t.Fatalf("unexpected subprotocol: %s", got)
+	}
+
+	start := time.Unix(1483228790, 500)
+	req := &ntpPacket{
+		Version:      ntpVersion,
+		Mode:         ntpModeClient,
+		TransmitTime: toNTPTime(start),
+	}
+	b, _ := req.MarshalBinary()
+	if err := conn.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		t.Fatal(err)
+	}
+	typ, b, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != websocket.BinaryMessage {
+		t.Fatalf("unexpected message type: %d", typ)
+	}
+	if len(b) != ntpPacketSize+ntpLeapExtensionSize {
+		t.Fatalf("unexpected length: %d", len(b))
+	}
+
+	var res ntpPacket
+	if err := res.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if res.Leap != ntpLeapAddSecond {
+		t.Errorf("unexpected leap indicator: %d", res.Leap)
+	}
+	if res.Mode != ntpModeServer {
+		t.Errorf("unexpected mode: %d", res.Mode)
+	}
+	if res.OriginTime != req.TransmitTime {
+		t.Errorf("unexpected origin time: %#016x", uint64(res.OriginTime))
+	}
+	if got := res.TransmitTime.Time(); !got.Equal(now) {
+		t.Errorf("unexpected transmit time: %s", got)
+	}
+
+	result, err := ntpResult(&res, nil, req.TransmitTime, start, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := time.Parse(time.RFC3339, "2017-01-01T00:00:00Z"); !result.NextLeap.Equal(want) {
+		t.Errorf("unexpected next leap: %s", result.NextLeap)
+	}
+
+	ext, ok := findNTPLeapExtension(b[ntpPacketSize:])
+	if !ok {
+		t.Fatal("the leap second extension is not found")
+	}
+	if ext.Leap != 36 || ext.Step != 1 {
+		t.Errorf("unexpected extension: %#v", ext)
+	}
+}
+
+func TestGetWebSocket_Subprotocol(t *testing.T) {
+	defer func(f func() time.Time) { clientStartTime = f }(clientStartTime)
+	clientStartTime = func() time.Time {
+		return time.Unix(1234567890, 0)
+	}
+	defer func(f func() time.Time) { clientEndTime = f }(clientEndTime)
+	clientEndTime = func() time.Time {
+		return time.Unix(1234567892, 0)
+	}
+
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Unix(1234567895, 0)
+		}),
+		LeapSecondsPath: "testdata/leap-seconds-2019-05-02.list",
+	}
+	s.Start()
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+
+	for _, subprotocol := range []string{Subprotocol, SubprotocolNTP} {
+		c := &Client{
+			Dialer: &websocket.Dialer{
+				Proxy:        http.ProxyFromEnvironment,
+				Subprotocols: []string{subprotocol},
+			},
+		}
+		result, err := c.Get(context.Background(), u.String())
+		if err != nil {
+			t.Fatalf("%s: %v", subprotocol, err)
+		}
+		if result.Offset != 4*time.Second {
+			t.Errorf("%s: unexpected offset, want %s, got %s", subprotocol, 4*time.Second, result.Offset)
+		}
+		if result.Delay != 2*time.Second {
+			t.Errorf("%s: unexpected delay, want %s, got %s", subprotocol, 2*time.Second, result.Delay)
+		}
+		if result.TAIOffset != 34*time.Second {
+			t.Errorf("%s: unexpected TAI offset, want %s, got %s", subprotocol, 34*time.Second, result.TAIOffset)
+		}
+		if want := time.Unix(1341100800, 0); !result.NextLeap.Equal(want) {
+			t.Errorf("%s: unexpected next leap, want %s, got %s", subprotocol, want, result.NextLeap)
+		}
+		if result.Step != 1 {
+			t.Errorf("%s: unexpected step, want 1, got %d", subprotocol, result.Step)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package webntp
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"time"
+)
+
+// defaultNTPPort is the default port of NTP.
+const defaultNTPPort = "123"
+
+// defaultNTPTimeout is the timeout of NTP queries if the context has no deadline.
+const defaultNTPTimeout = 5 * time.Second
+
+// getNTP queries the time with SNTPv4 (RFC 4330) over UDP.
+func (c *Client) getNTP(ctx context.Context, u *url.URL) (Result, error) {
+	if len(c.TrustedKeys) > 0 {
+		return Result{}, errUnsignedProtocol
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultNTPPort)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultNTPTimeout)
+		defer cancel()
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", host)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return Result{}, err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		// interrupt the blocking read.
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	req := &ntpPacket{
+		Version:      ntpVersion,
+		Mode:         ntpModeClient,
+		TransmitTime: randomNTPTime(),
+	}
+	b, err := req.MarshalBinary()
+	if err != nil {
+		return Result{}, err
+	}
+
+	// Send the request
+	start := clientStartTime()
+	if _, err := conn.Write(b); err != nil {
+		return Result{}, err
+	}
+
+	// Receive the response.
+	// ignore the packets that are not the response to our request.
+	buf := make([]byte, maxNTPRequestSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return Result{}, ctx.Err()
+			}
+			return Result{}, err
+		}
+		end := clientEndTime()
+
+		var res ntpPacket
+		if err := res.UnmarshalBinary(buf[:n]); err != nil {
+			continue
+		}
+		if res.Mode != ntpModeServer || res.OriginTime != req.TransmitTime {
+			continue
+		}
+		var ext *ntpLeapExtension
+		if e, ok := findNTPLeapExtension(buf[ntpPacketSize:n]); ok {
+			ext = &e
+		}
+		return ntpResult(&res, ext, req.TransmitTime, start, end)
+	}
+}
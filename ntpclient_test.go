@@ -0,0 +1,126 @@
+package webntp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetNTP(t *testing.T) {
+	defer func(f func() time.Time) { clientStartTime = f }(clientStartTime)
+	clientStartTime = func() time.Time {
+		return time.Unix(1234567890, 0)
+	}
+	defer func(f func() time.Time) { clientEndTime = f }(clientEndTime)
+	clientEndTime = func() time.Time {
+		return time.Unix(1234567892, 0)
+	}
+
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Unix(1234567895, 0)
+		}),
+	}
+	s.Start()
+	defer s.Close()
+	addr, _ := startNTPServer(t, s)
+
+	c := &Client{}
+	result, err := c.Get(context.Background(), "ntp://"+addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Offset != 4*time.Second {
+		t.Errorf("unexpected offset, want %s, got %s", 4*time.Second, result.Offset)
+	}
+	if result.Delay != 2*time.Second {
+		t.Errorf("unexpected delay, want %s, got %s", 2*time.Second, result.Delay)
+	}
+}
+
+func TestGetNTP_LeapIndicator(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2016-12-31T12:00:00Z")
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return now
+		}),
+		LeapSecondsPath: "testdata/leap-seconds-2019-05-02.list",
+	}
+	s.Start()
+	defer s.Close()
+	addr, _ := startNTPServer(t, s)
+
+	c := &Client{}
+	result, err := c.Get(context.Background(), "ntp://"+addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := time.Parse(time.RFC3339, "2017-01-01T00:00:00Z"); !result.NextLeap.Equal(want) {
+		t.Errorf("unexpected next leap: want %s, got %s", want, result.NextLeap)
+	}
+	if result.Step != 1 {
+		t.Errorf("unexpected step: want 1, got %d", result.Step)
+	}
+}
+
+func TestGetNTP_KissOfDeath(t *testing.T) {
+	s := &Server{
+		// the embedded list is valid.
+		Clock: ClockFunc(func() time.Time {
+			return time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+		}),
+		RequestRateLimit: RateLimit{Rate: 0.001, Burst: 1},
+	}
+	s.Start()
+	defer s.Close()
+	addr, _ := startNTPServer(t, s)
+
+	c := &Client{}
+	if _, err := c.Get(context.Background(), "ntp://"+addr); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.Get(context.Background(), "ntp://"+addr)
+	var kod *KissOfDeathError
+	if !errors.As(err, &kod) {
+		t.Fatalf("want KissOfDeathError, got %v", err)
+	}
+	if kod.Code != "RATE" {
+		t.Errorf("unexpected kiss code: %q", kod.Code)
+	}
+}
+
+func TestGetNTP_Timeout(t *testing.T) {
+	// nobody answers.
+	s := &Server{}
+	s.Start()
+	defer s.Close()
+	addr, done := startNTPServer(t, s)
+	s.Close()
+	<-done
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c := &Client{}
+	if _, err := c.Get(ctx, "ntp://"+addr); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestGetNTP_Stale(t *testing.T) {
+	// the embedded list has been expired, so the server raises the alarm.
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+		}),
+	}
+	s.Start()
+	defer s.Close()
+	addr, _ := startNTPServer(t, s)
+
+	c := &Client{}
+	if _, err := c.Get(context.Background(), "ntp://"+addr); err == nil || !strings.Contains(err.Error(), "not synchronized") {
+		t.Errorf("want not synchronized, got %v", err)
+	}
+}
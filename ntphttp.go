@@ -0,0 +1,144 @@
+package webntp
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+)
+
+// ContentTypeNTP is the content type of NTP over HTTP.
+// The body is an NTP packet defined in RFC 5905.
+const ContentTypeNTP = "application/ntp"
+
+// maxNTPRequestSize is the maximum size of NTP over HTTP requests.
+const maxNTPRequestSize = 1024
+
+// isNTPRequest reports whether req is an NTP over HTTP request.
+func isNTPRequest(req *http.Request) bool {
+	if req.Method != http.MethodPost {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return err == nil && mediaType == ContentTypeNTP
+}
+
+// NTPHandler returns a handler that serves NTP over HTTP.
+// It accepts POST requests whose body is an NTP client packet,
+// and responds with an NTP server packet.
+// If the request carries the leap second extension field, the response also carries it.
+func (s *Server) NTPHandler() http.Handler {
+	return s.handler(s.serveNTP)
+}
+
+func (s *Server) serveNTP(rw http.ResponseWriter, req *http.Request) {
+	begin := time.Now()
+	if req.Method != http.MethodPost {
+		rw.Header().Set("Allow", "POST")
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxNTPRequestSize))
+	if err != nil {
+		return
+	}
+	recv := s.now()
+
+	var p ntpPacket
+	if err := p.UnmarshalBinary(body); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if p.Mode != ntpModeClient {
+		http.Error(rw, fmt.Sprintf("webntp: unexpected ntp mode: %d", p.Mode), http.StatusBadRequest)
+		return
+	}
+
+	now := s.now()
+	leap := s.getLeapSecond(now)
+	res := s.ntpResponse(&p, recv, now, leap)
+	buf := make([]byte, 0, ntpPacketSize+ntpLeapExtensionSize)
+	buf = res.appendBinary(buf)
+	if _, ok := findNTPLeapExtension(body[ntpPacketSize:]); ok {
+		buf = s.ntpLeapExtension(leap, now).appendBinary(buf)
+	}
+
+	rw.Header().Set("Content-Type", ContentTypeNTP)
+	rw.Header().Set("Cache-Control", "no-cache, no-store")
+	rw.Write(buf)
+	s.metrics.observe(protocolNTPOverHTTP, begin)
+}
+
+// randomNTPTime returns a random transmit timestamp for client requests.
+// It prevents off-path attackers from spoofing the responses. RFC 9109.
+func randomNTPTime() ntpTime {
+	var b [8]byte
+	crand.Read(b[:])
+	return ntpTime(binary.BigEndian.Uint64(b[:]))
+}
+
+func (c *Client) getNTPOverHTTP(ctx context.Context, uri string) (Result, error) {
+	if len(c.TrustedKeys) > 0 {
+		return Result{}, errUnsignedProtocol
+	}
+	req := &ntpPacket{
+		Version:      ntpVersion,
+		Mode:         ntpModeClient,
+		TransmitTime: randomNTPTime(),
+	}
+	body := make([]byte, 0, ntpPacketSize+ntpLeapExtensionSize)
+	body = req.appendBinary(body)
+	// request the leap second extension field.
+	body = (&ntpLeapExtension{}).appendBinary(body)
+
+	httpReq, err := http.NewRequest(http.MethodPost, uri, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	httpReq.Header.Set("User-Agent", "webntp.shogo82148.com")
+	httpReq.Header.Set("Content-Type", ContentTypeNTP)
+
+	// Install ClientTrace
+	var start, end time.Time
+	trace := &httptrace.ClientTrace{
+		WroteRequest:         func(info httptrace.WroteRequestInfo) { start = clientStartTime() },
+		GotFirstResponseByte: func() { end = clientEndTime() },
+	}
+	ctx = httptrace.WithClientTrace(ctx, trace)
+	httpReq = httpReq.WithContext(ctx)
+
+	// Send the request
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("webntp: unexpected status code: %d", resp.StatusCode)
+	}
+
+	// Parse the response
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxNTPRequestSize))
+	if err != nil {
+		return Result{}, err
+	}
+	var res ntpPacket
+	if err := res.UnmarshalBinary(b); err != nil {
+		return Result{}, err
+	}
+	var ext *ntpLeapExtension
+	if e, ok := findNTPLeapExtension(b[ntpPacketSize:]); ok {
+		ext = &e
+	}
+	return ntpResult(&res, ext, req.TransmitTime, start, end)
+}
@@ -0,0 +1,151 @@
+package webntp
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_NTPOverHTTP(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2016-12-31T23:59:59Z")
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return now
+		}),
+		LeapSecondsPath: "testdata/leap-seconds-2019-05-02.list",
+		Stratum:         2,
+		ReferenceID:     "GPS",
+	}
+	s.Start()
+	defer s.Close()
+
+	p := &ntpPacket{
+		Version:      3,
+		Mode:         ntpModeClient,
+		TransmitTime: 0x0123456789abcdef,
+	}
+	body, _ := p.MarshalBinary()
+
+	t.Run("plain packet", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/", bytes.NewReader(body))
+		req.Header.Set("Content-Type", ContentTypeNTP)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: want %d, got %d", http.StatusOK, w.Code)
+		}
+		if got := w.Header().Get("Content-Type"); got != ContentTypeNTP {
+			t.Errorf("unexpected Content-Type: %q", got)
+		}
+		if w.Body.Len() != ntpPacketSize {
+			t.Fatalf("unexpected length: %d", w.Body.Len())
+		}
+
+		var res ntpPacket
+		if err := res.UnmarshalBinary(w.Body.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		want := ntpPacket{
+			Leap:           ntpLeapAddSecond,
+			Version:        3,
+			Mode:           ntpModeServer,
+			Stratum:        2,
+			Precision:      defaultPrecision,
+			RootDispersion: toNTPShort(defaultRootDispersion),
+			ReferenceID:    [4]byte{'G', 'P', 'S', 0},
+			ReferenceTime:  toNTPTime(now),
+			OriginTime:     0x0123456789abcdef,
+			ReceiveTime:    toNTPTime(now),
+			TransmitTime:   toNTPTime(now),
+		}
+		if res != want {
+			t.Errorf("want %#v, got %#v", want, res)
+		}
+	})
+
+	t.Run("with leap second extension", func(t *testing.T) {
+		b := (&ntpLeapExtension{}).appendBinary(append([]byte(nil), body...))
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/", bytes.NewReader(b))
+		req.Header.Set("Content-Type", ContentTypeNTP)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Body.Len() != ntpPacketSize+ntpLeapExtensionSize {
+			t.Fatalf("unexpected length: %d", w.Body.Len())
+		}
+		ext, ok := findNTPLeapExtension(w.Body.Bytes()[ntpPacketSize:])
+		if !ok {
+			t.Fatal("the leap second extension is not found")
+		}
+		if ext.Leap != 36 || ext.Step != 1 {
+			t.Errorf("unexpected extension: %#v", ext)
+		}
+	})
+
+	t.Run("too short", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/", bytes.NewReader(body[:10]))
+		req.Header.Set("Content-Type", ContentTypeNTP)
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("unexpected status code: want %d, got %d", http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		w := httptest.NewRecorder()
+		s.NTPHandler().ServeHTTP(w, req)
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("unexpected status code: want %d, got %d", http.StatusMethodNotAllowed, w.Code)
+		}
+	})
+}
+
+func TestGetNTPOverHTTP(t *testing.T) {
+	defer func(f func() time.Time) { clientStartTime = f }(clientStartTime)
+	clientStartTime = func() time.Time {
+		return time.Unix(1234567890, 0)
+	}
+	defer func(f func() time.Time) { clientEndTime = f }(clientEndTime)
+	clientEndTime = func() time.Time {
+		return time.Unix(1234567892, 0)
+	}
+
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Unix(1234567895, 0)
+		}),
+		LeapSecondsPath: "testdata/leap-seconds-2019-05-02.list",
+	}
+	s.Start()
+	defer s.Close()
+	ts := httptest.NewServer(s.Router("/api"))
+	defer ts.Close()
+
+	testCases := []struct {
+		client *Client
+		uri    string
+	}{
+		{&Client{}, strings.Replace(ts.URL, "http://", "ntp+http://", 1) + "/api"},
+		{&Client{NTPOverHTTP: true}, ts.URL + "/api"},
+	}
+	for _, tc := range testCases {
+		result, err := tc.client.Get(context.Background(), tc.uri)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.uri, err)
+		}
+		if result.Offset != 4*time.Second {
+			t.Errorf("%s: unexpected offset, want %s, got %s", tc.uri, 4*time.Second, result.Offset)
+		}
+		if result.Delay != 2*time.Second {
+			t.Errorf("%s: unexpected delay, want %s, got %s", tc.uri, 2*time.Second, result.Delay)
+		}
+		if result.TAIOffset != 34*time.Second {
+			t.Errorf("%s: unexpected TAI offset, want %s, got %s", tc.uri, 34*time.Second, result.TAIOffset)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package webntp
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// kiss codes of Kiss-o'-Death packets. RFC 5905 Section 7.4.
+var kissCodeRate = [4]byte{'R', 'A', 'T', 'E'}
+
+// ListenAndServeNTP listens on the UDP network address addr
+// and then calls ServeNTP to handle NTP requests.
+func (s *Server) ListenAndServeNTP(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeNTP(conn)
+}
+
+// ServeNTP answers NTP client requests (mode 3) received on conn,
+// using the same clock and leap seconds list as the HTTP server.
+// RequestRateLimit is applied per client IP address,
+// and the clients exceeding the limit receive RATE Kiss-o'-Death packets.
+// The server must be started by Start.
+// ServeNTP always returns a non-nil error. After Close, the returned error is net.ErrClosed.
+func (s *Server) ServeNTP(conn net.PacketConn) error {
+	s.wg.Add(1)
+	defer s.wg.Done()
+	defer conn.Close()
+	stop := context.AfterFunc(s.ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	buf := make([]byte, maxNTPRequestSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return net.ErrClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		recv := s.now()
+		s.handleNTP(conn, addr, buf[:n], recv)
+	}
+}
+
+func (s *Server) handleNTP(conn net.PacketConn, addr net.Addr, body []byte, recv time.Time) {
+	begin := time.Now()
+
+	var req ntpPacket
+	if err := req.UnmarshalBinary(body); err != nil {
+		s.logger().Debug("invalid ntp packet",
+			slog.String("remote_addr", addr.String()),
+			slog.String("protocol", protocolNTP.String()),
+			slog.Any("err", err),
+		)
+		return
+	}
+	if req.Mode != ntpModeClient {
+		// we are a server. ignore other modes.
+		return
+	}
+
+	if s.RequestRateLimit.enabled() {
+		if ok, _ := s.limiter.allow(s.RequestRateLimit, clientIP(addr.String()), begin); !ok {
+			s.metrics.rejectedRateLimit.Add(1)
+			s.writeNTP(conn, addr, s.kissOfDeath(&req, kissCodeRate))
+			return
+		}
+	}
+
+	now := s.now()
+	leap := s.getLeapSecond(now)
+	res := s.ntpResponse(&req, recv, now, leap)
+	buf := make([]byte, 0, ntpPacketSize+ntpLeapExtensionSize)
+	buf = res.appendBinary(buf)
+	if req.Version == ntpVersion {
+		if _, ok := findNTPLeapExtension(body[ntpPacketSize:]); ok {
+			buf = s.ntpLeapExtension(leap, now).appendBinary(buf)
+		}
+	}
+	if s.writeNTP(conn, addr, buf) {
+		s.metrics.observe(protocolNTP, begin)
+	}
+}
+
+// kissOfDeath makes a Kiss-o'-Death packet. RFC 5905 Section 7.4.
+func (s *Server) kissOfDeath(req *ntpPacket, code [4]byte) []byte {
+	res := &ntpPacket{
+		Leap:        ntpLeapNotInSync,
+		Version:     req.Version,
+		Mode:        ntpModeServer,
+		Stratum:     0,
+		Poll:        req.Poll,
+		Precision:   defaultPrecision,
+		ReferenceID: code,
+		OriginTime:  req.TransmitTime,
+	}
+	return res.appendBinary(make([]byte, 0, ntpPacketSize))
+}
+
+func (s *Server) writeNTP(conn net.PacketConn, addr net.Addr, buf []byte) bool {
+	if _, err := conn.WriteTo(buf, addr); err != nil {
+		s.logger().Warn("failed to send ntp response",
+			slog.String("remote_addr", addr.String()),
+			slog.String("protocol", protocolNTP.String()),
+			slog.Any("err", err),
+		)
+		return false
+	}
+	return true
+}
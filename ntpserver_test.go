@@ -0,0 +1,121 @@
+package webntp
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func startNTPServer(t *testing.T, s *Server) (addr string, done <-chan error) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan error, 1)
+	go func() {
+		ch <- s.ServeNTP(conn)
+	}()
+	return conn.LocalAddr().String(), ch
+}
+
+func exchangeNTP(t *testing.T, addr string, req []byte) *ntpPacket {
+	t.Helper()
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res ntpPacket
+	if err := res.UnmarshalBinary(buf[:n]); err != nil {
+		t.Fatal(err)
+	}
+	return &res
+}
+
+func TestServer_ServeNTP(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2016-12-31T23:59:59Z")
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return now
+		}),
+		LeapSecondsPath: "testdata/leap-seconds-2019-05-02.list",
+	}
+	s.Start()
+	addr, done := startNTPServer(t, s)
+
+	req := &ntpPacket{
+		Version:      ntpVersion,
+		Mode:         ntpModeClient,
+		TransmitTime: 0x0123456789abcdef,
+	}
+	b, _ := req.MarshalBinary()
+	res := exchangeNTP(t, addr, b)
+	want := ntpPacket{
+		Leap:           ntpLeapAddSecond,
+		Version:        ntpVersion,
+		Mode:           ntpModeServer,
+		Stratum:        defaultStratum,
+		Precision:      defaultPrecision,
+		RootDispersion: toNTPShort(defaultRootDispersion),
+		ReferenceID:    [4]byte{'W', 'N', 'T', 'P'},
+		ReferenceTime:  toNTPTime(now),
+		OriginTime:     0x0123456789abcdef,
+		ReceiveTime:    toNTPTime(now),
+		TransmitTime:   toNTPTime(now),
+	}
+	if *res != want {
+		t.Errorf("want %#v, got %#v", want, *res)
+	}
+
+	s.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("want %v, got %v", net.ErrClosed, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("ServeNTP doesn't return after Close")
+	}
+}
+
+func TestServer_ServeNTP_RateLimit(t *testing.T) {
+	s := &Server{
+		RequestRateLimit: RateLimit{Rate: 0.001, Burst: 1},
+	}
+	s.Start()
+	defer s.Close()
+	addr, _ := startNTPServer(t, s)
+
+	req := &ntpPacket{
+		Version:      ntpVersion,
+		Mode:         ntpModeClient,
+		TransmitTime: 0x0123456789abcdef,
+	}
+	b, _ := req.MarshalBinary()
+	if res := exchangeNTP(t, addr, b); res.Stratum != defaultStratum {
+		t.Errorf("unexpected stratum: %d", res.Stratum)
+	}
+
+	// Kiss-o'-Death
+	res := exchangeNTP(t, addr, b)
+	if res.Stratum != 0 {
+		t.Errorf("unexpected stratum: %d", res.Stratum)
+	}
+	if res.ReferenceID != kissCodeRate {
+		t.Errorf("unexpected kiss code: %q", res.ReferenceID[:])
+	}
+	if res.OriginTime != req.TransmitTime {
+		t.Errorf("unexpected origin time: %#016x", uint64(res.OriginTime))
+	}
+}
@@ -0,0 +1,226 @@
+package webntp
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit is a configuration of a token bucket rate limiter.
+type RateLimit struct {
+	// Rate is the number of events allowed per second.
+	// Zero means no limit.
+	Rate float64
+
+	// Burst is the maximum number of events allowed at once.
+	// If zero, it defaults to Rate rounded up (at least 1).
+	Burst int
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Rate > 0
+}
+
+func (l RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(1, math.Ceil(l.Rate))
+}
+
+// tokenBucket is a token bucket. It is not safe for concurrent use.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(l RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		tokens: l.burst(),
+		last:   now,
+	}
+}
+
+// allow reports whether an event may happen at now.
+// If not, it also returns how long to wait for the next token.
+func (b *tokenBucket) allow(l RateLimit, now time.Time) (bool, time.Duration) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(l.burst(), b.tokens+elapsed.Seconds()*l.Rate)
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.Rate * float64(time.Second))
+	return false, wait
+}
+
+// full reports whether the bucket has been refilled at now.
+func (b *tokenBucket) full(l RateLimit, now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*l.Rate >= l.burst()
+}
+
+// sweepInterval is the interval to remove idle buckets from rateLimiter.
+const sweepInterval = time.Minute
+
+// fullSweepInterval is the minimum interval to sweep rateLimiter when it is full.
+const fullSweepInterval = time.Second
+
+// maxRateLimitBuckets is the maximum number of the buckets in rateLimiter.
+// The source addresses of UDP packets can be spoofed, so the buckets must be bounded.
+// It is a variable for tests.
+var maxRateLimitBuckets = 1 << 16
+
+// rateLimiter is a set of token buckets keyed by the client address.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// allow reports whether the client at ip may send a request at now.
+// If the limiter is full of the other clients, e.g. a flood from spoofed addresses,
+// the new clients are rejected until the idle buckets are swept.
+func (r *rateLimiter) allow(l RateLimit, ip string, now time.Time) (bool, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.buckets == nil {
+		r.buckets = make(map[string]*tokenBucket)
+		r.lastSweep = now
+	}
+	if now.Sub(r.lastSweep) >= sweepInterval {
+		r.sweep(l, now)
+	}
+
+	key := rateLimitKey(ip)
+	b, ok := r.buckets[key]
+	if !ok {
+		if len(r.buckets) >= maxRateLimitBuckets && now.Sub(r.lastSweep) >= fullSweepInterval {
+			r.sweep(l, now)
+		}
+		if len(r.buckets) >= maxRateLimitBuckets {
+			return false, fullSweepInterval
+		}
+		b = newTokenBucket(l, now)
+		r.buckets[key] = b
+	}
+	return b.allow(l, now)
+}
+
+// rateLimitKey returns the key of the client at ip in rateLimiter.
+// IPv6 clients are keyed by /64, because a /64 is usually assigned to a single site.
+func rateLimitKey(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	if addr.Is4() {
+		return addr.String()
+	}
+	prefix, err := addr.WithZone("").Prefix(64)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
+
+// sweep removes the buckets that have been refilled.
+// They are the same as new ones, so we don't need to remember them.
+func (r *rateLimiter) sweep(l RateLimit, now time.Time) {
+	for key, b := range r.buckets {
+		if b.full(l, now) {
+			delete(r.buckets, key)
+		}
+	}
+	r.lastSweep = now
+}
+
+// clientIP returns the IP address part of remoteAddr.
+func clientIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// parseTrustedProxies parses the IP addresses and the CIDRs of Server.TrustedProxies.
+func parseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("webntp: invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("webntp: invalid trusted proxy %q: %w", proxy, err)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// trustedProxy reports whether ip is one of TrustedProxies.
+func (s *Server) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap().WithZone("")
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestIP returns the IP address of the client of req.
+// If the request comes from TrustedProxies, the client is the nearest address
+// in X-Forwarded-For that is not a trusted proxy.
+func (s *Server) requestIP(req *http.Request) string {
+	ip := clientIP(req.RemoteAddr)
+	if len(s.trustedProxies) == 0 || !s.trustedProxy(ip) {
+		return ip
+	}
+	var hops []string
+	for _, v := range req.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			// malformed. the nearest trusted proxy is the client.
+			break
+		}
+		ip = hop
+		if !s.trustedProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// retryAfter formats d as the value of the Retry-After header.
+func retryAfter(d time.Duration) string {
+	sec := int64(math.Ceil(d.Seconds()))
+	if sec < 1 {
+		sec = 1
+	}
+	return strconv.FormatInt(sec, 10)
+}
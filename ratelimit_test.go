@@ -0,0 +1,271 @@
+package webntp
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTokenBucket(t *testing.T) {
+	l := RateLimit{Rate: 2, Burst: 3}
+	now := time.Unix(1234567890, 0)
+	b := newTokenBucket(l, now)
+
+	// consume the burst.
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.allow(l, now); !ok {
+			t.Fatalf("%d: want allowed, got denied", i)
+		}
+	}
+	ok, wait := b.allow(l, now)
+	if ok {
+		t.Fatal("want denied, got allowed")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("unexpected wait: want %s, got %s", 500*time.Millisecond, wait)
+	}
+
+	// a token is refilled in 500ms.
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := b.allow(l, now); !ok {
+		t.Fatal("want allowed, got denied")
+	}
+	if ok, _ := b.allow(l, now); ok {
+		t.Fatal("want denied, got allowed")
+	}
+
+	// the bucket never exceeds the burst.
+	now = now.Add(time.Hour)
+	if !b.full(l, now) {
+		t.Error("want full")
+	}
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.allow(l, now); !ok {
+			t.Fatalf("%d: want allowed, got denied", i)
+		}
+	}
+	if ok, _ := b.allow(l, now); ok {
+		t.Fatal("want denied, got allowed")
+	}
+}
+
+func TestRateLimiter_Sweep(t *testing.T) {
+	l := RateLimit{Rate: 1}
+	now := time.Unix(1234567890, 0)
+	var r rateLimiter
+	r.allow(l, "192.0.2.1", now)
+	r.allow(l, "192.0.2.2", now)
+	if len(r.buckets) != 2 {
+		t.Fatalf("want 2 buckets, got %d", len(r.buckets))
+	}
+
+	now = now.Add(sweepInterval)
+	r.allow(l, "192.0.2.3", now)
+	if len(r.buckets) != 1 {
+		t.Errorf("want 1 bucket, got %d", len(r.buckets))
+	}
+}
+
+func TestRateLimiter_Full(t *testing.T) {
+	defer func(max int) { maxRateLimitBuckets = max }(maxRateLimitBuckets)
+	maxRateLimitBuckets = 2
+
+	l := RateLimit{Rate: 1, Burst: 1}
+	now := time.Unix(1234567890, 0)
+	var r rateLimiter
+	r.allow(l, "192.0.2.1", now)
+	r.allow(l, "192.0.2.2", now)
+
+	// new clients are rejected while the limiter is full.
+	if ok, wait := r.allow(l, "192.0.2.3", now); ok || wait <= 0 {
+		t.Errorf("want rejected, got %t, %s", ok, wait)
+	}
+	if len(r.buckets) != 2 {
+		t.Errorf("want 2 buckets, got %d", len(r.buckets))
+	}
+
+	// the idle buckets are swept early.
+	now = now.Add(fullSweepInterval)
+	if ok, _ := r.allow(l, "192.0.2.3", now); !ok {
+		t.Error("want allowed, got rejected")
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"192.0.2.1", "192.0.2.1"},
+		{"::ffff:192.0.2.1", "192.0.2.1"},
+		{"2001:db8:1:2:3:4:5:6", "2001:db8:1:2::/64"},
+		{"2001:db8:1:2::1", "2001:db8:1:2::/64"},
+		{"fe80::1%eth0", "fe80::/64"},
+		{"pipe", "pipe"},
+	}
+	for _, tt := range tests {
+		if got := rateLimitKey(tt.ip); got != tt.want {
+			t.Errorf("rateLimitKey(%q): want %q, got %q", tt.ip, tt.want, got)
+		}
+	}
+}
+
+func TestServer_RequestIP(t *testing.T) {
+	s := &Server{
+		TrustedProxies: []string{"10.0.0.0/8", "2001:db8::1"},
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		remoteAddr string
+		xff        []string
+		want       string
+	}{
+		{"192.0.2.1:1234", nil, "192.0.2.1"},
+		// X-Forwarded-For from untrusted clients is ignored.
+		{"192.0.2.1:1234", []string{"198.51.100.1"}, "192.0.2.1"},
+		{"10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"[2001:db8::1]:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		// the client can prepend any address, so the nearest untrusted address is used.
+		{"10.0.0.1:1234", []string{"203.0.113.1, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"203.0.113.1", "198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"10.0.0.1:1234", []string{"garbage, 10.0.0.2"}, "10.0.0.2"},
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for _, v := range tt.xff {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		if got := s.requestIP(req); got != tt.want {
+			t.Errorf("%s %q: want %s, got %s", tt.remoteAddr, tt.xff, tt.want, got)
+		}
+	}
+}
+
+func TestServer_InvalidTrustedProxies(t *testing.T) {
+	s := &Server{
+		TrustedProxies: []string{"10.0.0.0/33"},
+	}
+	if err := s.Start(); err == nil {
+		s.Close()
+		t.Error("want error, got nil")
+	}
+}
+
+func TestServer_RequestRateLimit(t *testing.T) {
+	s := &Server{
+		RequestRateLimit: RateLimit{Rate: 0.001, Burst: 2},
+	}
+	s.Start()
+	defer s.Close()
+
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := serve("192.0.2.1:1234"); w.Code != http.StatusOK {
+			t.Errorf("%d: unexpected status code: want %d, got %d", i, http.StatusOK, w.Code)
+		}
+	}
+	w := serve("192.0.2.1:5678")
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("unexpected status code: want %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After header is missing")
+	}
+
+	// other clients are not limited.
+	if w := serve("192.0.2.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("unexpected status code: want %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// IPv6 clients are limited per /64.
+	for i := 0; i < 2; i++ {
+		if w := serve(fmt.Sprintf("[2001:db8::%d]:1234", i+1)); w.Code != http.StatusOK {
+			t.Errorf("%d: unexpected status code: want %d, got %d", i, http.StatusOK, w.Code)
+		}
+	}
+	if w := serve("[2001:db8::3]:1234"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("unexpected status code: want %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+}
+
+func TestServer_MaxConcurrency(t *testing.T) {
+	s := &Server{
+		MaxConcurrency: 1,
+	}
+	s.Start()
+	defer s.Close()
+
+	// simulate a request in flight.
+	s.concurrency.Add(1)
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status code: want %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("unexpected Retry-After: want %q, got %q", "1", got)
+	}
+
+	s.concurrency.Add(-1)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("unexpected status code: want %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestServer_MessageRateLimit(t *testing.T) {
+	s := &Server{
+		MessageRateLimit: RateLimit{Rate: 0.001, Burst: 1},
+	}
+	s.Start()
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	dialer := &websocket.Dialer{
+		Subprotocols: []string{Subprotocol},
+	}
+	conn, _, err := dialer.Dial(u.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("1234567890")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("1234567890")); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Errorf("want close error %d, got %v", websocket.CloseTryAgainLater, err)
+	}
+}
@@ -0,0 +1,513 @@
+package webntp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	crand "crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Roughtime support.
+// It implements the Google Roughtime protocol.
+// https://roughtime.googlesource.com/roughtime/+/HEAD/PROTOCOL.md
+
+// defaultRoughtimePort is the default port of Roughtime.
+const defaultRoughtimePort = "2002"
+
+// roughtimeMinRequestSize is the minimum size of requests.
+// It prevents the server from being used for amplification attacks.
+const roughtimeMinRequestSize = 1024
+
+// roughtimeNonceSize is the size of nonces.
+const roughtimeNonceSize = 64
+
+// roughtimeDelegationLifetime is the lifetime of delegated keys.
+const roughtimeDelegationLifetime = 24 * time.Hour
+
+// defaultRoughtimeRadius is the default radius of the server's uncertainty.
+const defaultRoughtimeRadius = time.Second
+
+// the contexts of signatures.
+var (
+	roughtimeResponseContext   = []byte("RoughTime v1 response signature\x00")
+	roughtimeDelegationContext = []byte("RoughTime v1 delegation signature--\x00")
+)
+
+// roughtimeTag is a tag of Roughtime messages.
+type roughtimeTag uint32
+
+func makeRoughtimeTag(s string) roughtimeTag {
+	return roughtimeTag(binary.LittleEndian.Uint32([]byte(s)))
+}
+
+var (
+	roughtimeTagSIG  = makeRoughtimeTag("SIG\x00")
+	roughtimeTagNONC = makeRoughtimeTag("NONC")
+	roughtimeTagDELE = makeRoughtimeTag("DELE")
+	roughtimeTagPATH = makeRoughtimeTag("PATH")
+	roughtimeTagRADI = makeRoughtimeTag("RADI")
+	roughtimeTagPUBK = makeRoughtimeTag("PUBK")
+	roughtimeTagMIDP = makeRoughtimeTag("MIDP")
+	roughtimeTagSREP = makeRoughtimeTag("SREP")
+	roughtimeTagMINT = makeRoughtimeTag("MINT")
+	roughtimeTagROOT = makeRoughtimeTag("ROOT")
+	roughtimeTagCERT = makeRoughtimeTag("CERT")
+	roughtimeTagMAXT = makeRoughtimeTag("MAXT")
+	roughtimeTagINDX = makeRoughtimeTag("INDX")
+	roughtimeTagPAD  = makeRoughtimeTag("PAD\xff")
+)
+
+var errInvalidRoughtimeMessage = errors.New("webntp: invalid roughtime message")
+
+// encodeRoughtimeMessage encodes msg.
+// The length of each value must be a multiple of four.
+func encodeRoughtimeMessage(msg map[roughtimeTag][]byte) ([]byte, error) {
+	tags := make([]roughtimeTag, 0, len(msg))
+	size := 4
+	for tag, value := range msg {
+		if len(value)%4 != 0 {
+			return nil, errInvalidRoughtimeMessage
+		}
+		tags = append(tags, tag)
+		size += 8 + len(value)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	b := make([]byte, 0, size)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(tags)))
+	var offset uint32
+	for i, tag := range tags {
+		if i > 0 {
+			b = binary.LittleEndian.AppendUint32(b, offset)
+		}
+		offset += uint32(len(msg[tag]))
+	}
+	for _, tag := range tags {
+		b = binary.LittleEndian.AppendUint32(b, uint32(tag))
+	}
+	for _, tag := range tags {
+		b = append(b, msg[tag]...)
+	}
+	return b, nil
+}
+
+// decodeRoughtimeMessage decodes b.
+func decodeRoughtimeMessage(b []byte) (map[roughtimeTag][]byte, error) {
+	if len(b) < 4 || len(b)%4 != 0 {
+		return nil, errInvalidRoughtimeMessage
+	}
+	n := int(binary.LittleEndian.Uint32(b))
+	if n == 0 {
+		return map[roughtimeTag][]byte{}, nil
+	}
+	headerSize := 4 + 4*(n-1) + 4*n
+	if n > len(b)/8 || headerSize > len(b) {
+		return nil, errInvalidRoughtimeMessage
+	}
+	offsets := b[4 : 4+4*(n-1)]
+	tags := b[4+4*(n-1) : headerSize]
+	values := b[headerSize:]
+
+	msg := make(map[roughtimeTag][]byte, n)
+	var lastTag roughtimeTag
+	start := 0
+	for i := 0; i < n; i++ {
+		tag := roughtimeTag(binary.LittleEndian.Uint32(tags[4*i:]))
+		if i > 0 && tag <= lastTag {
+			return nil, errInvalidRoughtimeMessage
+		}
+		lastTag = tag
+
+		end := len(values)
+		if i < n-1 {
+			end = int(binary.LittleEndian.Uint32(offsets[4*i:]))
+		}
+		if end < start || end > len(values) || end%4 != 0 {
+			return nil, errInvalidRoughtimeMessage
+		}
+		msg[tag] = values[start:end]
+		start = end
+	}
+	return msg, nil
+}
+
+func roughtimeHashLeaf(nonce []byte) []byte {
+	h := sha512.New()
+	h.Write([]byte{0x00})
+	h.Write(nonce)
+	return h.Sum(nil)
+}
+
+func roughtimeHashNode(left, right []byte) []byte {
+	h := sha512.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// roughtimeDelegation is a delegated key signed by the long-term key.
+type roughtimeDelegation struct {
+	key  ed25519.PrivateKey
+	cert []byte // CERT message
+	minT time.Time
+	maxT time.Time
+}
+
+func newRoughtimeDelegation(rootKey ed25519.PrivateKey, minT, maxT time.Time) (*roughtimeDelegation, error) {
+	pub, key, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	dele, err := encodeRoughtimeMessage(map[roughtimeTag][]byte{
+		roughtimeTagMINT: binary.LittleEndian.AppendUint64(nil, uint64(minT.UnixMicro())),
+		roughtimeTagMAXT: binary.LittleEndian.AppendUint64(nil, uint64(maxT.UnixMicro())),
+		roughtimeTagPUBK: pub,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sig := ed25519.Sign(rootKey, append(append([]byte{}, roughtimeDelegationContext...), dele...))
+	cert, err := encodeRoughtimeMessage(map[roughtimeTag][]byte{
+		roughtimeTagDELE: dele,
+		roughtimeTagSIG:  sig,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &roughtimeDelegation{
+		key:  key,
+		cert: cert,
+		minT: minT,
+		maxT: maxT,
+	}, nil
+}
+
+// roughtimeServer holds the delegated key of the server.
+type roughtimeServer struct {
+	mu         sync.Mutex
+	delegation *roughtimeDelegation
+}
+
+// getDelegation returns the delegated key valid at now.
+// It renews the key when it is about to expire.
+func (r *roughtimeServer) getDelegation(rootKey ed25519.PrivateKey, now time.Time) (*roughtimeDelegation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := r.delegation
+	if d != nil && now.After(d.minT) && now.Add(time.Hour).Before(d.maxT) {
+		return d, nil
+	}
+	d, err := newRoughtimeDelegation(rootKey, now.Add(-time.Hour), now.Add(roughtimeDelegationLifetime))
+	if err != nil {
+		return nil, err
+	}
+	r.delegation = d
+	return d, nil
+}
+
+// ListenAndServeRoughtime listens on the UDP network address addr
+// and then calls ServeRoughtime to handle Roughtime requests.
+func (s *Server) ListenAndServeRoughtime(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeRoughtime(conn)
+}
+
+// ServeRoughtime answers Roughtime requests received on conn,
+// using the same clock as the HTTP server.
+// The responses are signed by a delegated key, which is signed by RoughtimeKey.
+// RequestRateLimit is applied per client IP address.
+// The server must be started by Start.
+// ServeRoughtime always returns a non-nil error. After Close, the returned error is net.ErrClosed.
+func (s *Server) ServeRoughtime(conn net.PacketConn) error {
+	if len(s.RoughtimeKey) != ed25519.PrivateKeySize {
+		conn.Close()
+		return errors.New("webntp: RoughtimeKey is not set")
+	}
+
+	s.wg.Add(1)
+	defer s.wg.Done()
+	defer conn.Close()
+	stop := context.AfterFunc(s.ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	buf := make([]byte, 2*roughtimeMinRequestSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return net.ErrClosed
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		s.handleRoughtime(conn, addr, buf[:n])
+	}
+}
+
+func (s *Server) handleRoughtime(conn net.PacketConn, addr net.Addr, body []byte) {
+	begin := time.Now()
+	if len(body) < roughtimeMinRequestSize {
+		return
+	}
+	if s.RequestRateLimit.enabled() {
+		if ok, _ := s.limiter.allow(s.RequestRateLimit, clientIP(addr.String()), begin); !ok {
+			s.metrics.rejectedRateLimit.Add(1)
+			return
+		}
+	}
+
+	res, err := s.roughtimeResponse(body)
+	if err != nil {
+		s.logger().Debug("invalid roughtime request",
+			slog.String("remote_addr", addr.String()),
+			slog.String("protocol", protocolRoughtime.String()),
+			slog.Any("err", err),
+		)
+		return
+	}
+	if _, err := conn.WriteTo(res, addr); err != nil {
+		s.logger().Warn("failed to send roughtime response",
+			slog.String("remote_addr", addr.String()),
+			slog.String("protocol", protocolRoughtime.String()),
+			slog.Any("err", err),
+		)
+		return
+	}
+	s.metrics.observe(protocolRoughtime, begin)
+}
+
+func (s *Server) roughtimeResponse(body []byte) ([]byte, error) {
+	req, err := decodeRoughtimeMessage(body)
+	if err != nil {
+		return nil, err
+	}
+	nonce, ok := req[roughtimeTagNONC]
+	if !ok || len(nonce) != roughtimeNonceSize {
+		return nil, errors.New("webntp: invalid nonce")
+	}
+
+	now := s.now()
+	d, err := s.roughtime.getDelegation(s.RoughtimeKey, now)
+	if err != nil {
+		return nil, err
+	}
+	radius := s.RoughtimeRadius
+	if radius <= 0 {
+		radius = defaultRoughtimeRadius
+	}
+
+	// a Merkle tree with only one leaf.
+	srep, err := encodeRoughtimeMessage(map[roughtimeTag][]byte{
+		roughtimeTagROOT: roughtimeHashLeaf(nonce),
+		roughtimeTagMIDP: binary.LittleEndian.AppendUint64(nil, uint64(now.UnixMicro())),
+		roughtimeTagRADI: binary.LittleEndian.AppendUint32(nil, uint32(radius/time.Microsecond)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	sig := ed25519.Sign(d.key, append(append([]byte{}, roughtimeResponseContext...), srep...))
+	return encodeRoughtimeMessage(map[roughtimeTag][]byte{
+		roughtimeTagSIG:  sig,
+		roughtimeTagPATH: {},
+		roughtimeTagSREP: srep,
+		roughtimeTagCERT: d.cert,
+		roughtimeTagINDX: binary.LittleEndian.AppendUint32(nil, 0),
+	})
+}
+
+// RoughtimeVerificationError is the error returned when a Roughtime response fails verification.
+type RoughtimeVerificationError struct {
+	Reason string
+}
+
+func (e *RoughtimeVerificationError) Error() string {
+	return "webntp: roughtime verification failed: " + e.Reason
+}
+
+// roughtimePublicKey returns the long-term public key of the server.
+// It is the "pubkey" query parameter encoded in base64, or c.RoughtimeKeys[u.Host].
+func (c *Client) roughtimePublicKey(u *url.URL) (ed25519.PublicKey, error) {
+	if s := u.Query().Get("pubkey"); s != "" {
+		// '+' in unescaped keys is decoded as a space.
+		s = strings.ReplaceAll(s, " ", "+")
+		key, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("webntp: invalid roughtime public key: %w", err)
+		}
+		if len(key) != ed25519.PublicKeySize {
+			return nil, errors.New("webntp: invalid roughtime public key size")
+		}
+		return ed25519.PublicKey(key), nil
+	}
+	if key, ok := c.RoughtimeKeys[u.Host]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("webntp: roughtime public key for %s is unknown", u.Host)
+}
+
+// getRoughtime queries the time with Roughtime over UDP.
+func (c *Client) getRoughtime(ctx context.Context, u *url.URL) (Result, error) {
+	pubKey, err := c.roughtimePublicKey(u)
+	if err != nil {
+		return Result{}, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultRoughtimePort)
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultNTPTimeout)
+		defer cancel()
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", host)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return Result{}, err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		// interrupt the blocking read.
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	// build the request
+	nonce := make([]byte, roughtimeNonceSize)
+	if _, err := crand.Read(nonce); err != nil {
+		return Result{}, err
+	}
+	padding := roughtimeMinRequestSize - (4 + 4 + 8) - roughtimeNonceSize
+	req, err := encodeRoughtimeMessage(map[roughtimeTag][]byte{
+		roughtimeTagNONC: nonce,
+		roughtimeTagPAD:  make([]byte, padding),
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	// Send the request
+	start := clientStartTime()
+	if _, err := conn.Write(req); err != nil {
+		return Result{}, err
+	}
+
+	// Receive the response
+	buf := make([]byte, 2*roughtimeMinRequestSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		if ctx.Err() != nil {
+			return Result{}, ctx.Err()
+		}
+		return Result{}, err
+	}
+	end := clientEndTime()
+
+	midpoint, radius, err := verifyRoughtimeResponse(buf[:n], nonce, pubKey)
+	if err != nil {
+		return Result{}, err
+	}
+	delay := end.Sub(start)
+	offset := midpoint.Sub(start) - delay/2
+	return Result{
+		Delay:       delay,
+		Offset:      offset,
+		Uncertainty: radius,
+	}, nil
+}
+
+// verifyRoughtimeResponse verifies the response to the request with nonce,
+// and returns the midpoint and the radius.
+func verifyRoughtimeResponse(b, nonce []byte, pubKey ed25519.PublicKey) (time.Time, time.Duration, error) {
+	res, err := decodeRoughtimeMessage(b)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	// verify the delegation
+	cert, err := decodeRoughtimeMessage(res[roughtimeTagCERT])
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	dele := cert[roughtimeTagDELE]
+	if !ed25519.Verify(pubKey, append(append([]byte{}, roughtimeDelegationContext...), dele...), cert[roughtimeTagSIG]) {
+		return time.Time{}, 0, &RoughtimeVerificationError{Reason: "invalid delegation signature"}
+	}
+	delegation, err := decodeRoughtimeMessage(dele)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	mint, maxt, delegatedKey := delegation[roughtimeTagMINT], delegation[roughtimeTagMAXT], delegation[roughtimeTagPUBK]
+	if len(mint) != 8 || len(maxt) != 8 || len(delegatedKey) != ed25519.PublicKeySize {
+		return time.Time{}, 0, errInvalidRoughtimeMessage
+	}
+
+	// verify the signed response
+	srepBytes := res[roughtimeTagSREP]
+	if !ed25519.Verify(ed25519.PublicKey(delegatedKey), append(append([]byte{}, roughtimeResponseContext...), srepBytes...), res[roughtimeTagSIG]) {
+		return time.Time{}, 0, &RoughtimeVerificationError{Reason: "invalid response signature"}
+	}
+	srep, err := decodeRoughtimeMessage(srepBytes)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	root, midp, radi := srep[roughtimeTagROOT], srep[roughtimeTagMIDP], srep[roughtimeTagRADI]
+	if len(root) != sha512.Size || len(midp) != 8 || len(radi) != 4 {
+		return time.Time{}, 0, errInvalidRoughtimeMessage
+	}
+
+	// verify the Merkle proof
+	index, path := res[roughtimeTagINDX], res[roughtimeTagPATH]
+	if len(index) != 4 || len(path)%sha512.Size != 0 {
+		return time.Time{}, 0, errInvalidRoughtimeMessage
+	}
+	idx := binary.LittleEndian.Uint32(index)
+	hash := roughtimeHashLeaf(nonce)
+	for ; len(path) > 0; path = path[sha512.Size:] {
+		if idx&1 == 0 {
+			hash = roughtimeHashNode(hash, path[:sha512.Size])
+		} else {
+			hash = roughtimeHashNode(path[:sha512.Size], hash)
+		}
+		idx >>= 1
+	}
+	if !bytes.Equal(hash, root) {
+		return time.Time{}, 0, &RoughtimeVerificationError{Reason: "the nonce is not in the Merkle tree"}
+	}
+
+	// check the validity of the delegation
+	m := binary.LittleEndian.Uint64(midp)
+	if m < binary.LittleEndian.Uint64(mint) || m > binary.LittleEndian.Uint64(maxt) {
+		return time.Time{}, 0, &RoughtimeVerificationError{Reason: "the midpoint is out of the delegation"}
+	}
+
+	midpoint := time.UnixMicro(int64(m))
+	radius := time.Duration(binary.LittleEndian.Uint32(radi)) * time.Microsecond
+	return midpoint, radius, nil
+}
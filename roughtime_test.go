@@ -0,0 +1,269 @@
+package webntp
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	crand "crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func startRoughtimeServer(t *testing.T, s *Server) (addr string, done <-chan error) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan error, 1)
+	go func() {
+		ch <- s.ServeRoughtime(conn)
+	}()
+	return conn.LocalAddr().String(), ch
+}
+
+func TestRoughtimeMessage(t *testing.T) {
+	msg := map[roughtimeTag][]byte{
+		roughtimeTagPAD:  make([]byte, 8),
+		roughtimeTagNONC: bytes.Repeat([]byte{0x01}, 64),
+		roughtimeTagSIG:  {},
+		roughtimeTagINDX: {1, 2, 3, 4},
+	}
+	b, err := encodeRoughtimeMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 4+4*3+4*4+8+64+4 {
+		t.Errorf("unexpected size: %d", len(b))
+	}
+	got, err := decodeRoughtimeMessage(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(msg, got); diff != "" {
+		t.Errorf("message mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := encodeRoughtimeMessage(map[roughtimeTag][]byte{roughtimeTagNONC: {1, 2, 3}}); err == nil {
+		t.Error("want error for unaligned value, got nil")
+	}
+}
+
+func TestDecodeRoughtimeMessage_Invalid(t *testing.T) {
+	tests := map[string][]byte{
+		"empty":             {},
+		"unaligned":         {1, 0, 0, 0, 0},
+		"too many tags":     {0xff, 0xff, 0, 0, 0, 0, 0, 0},
+		"unsorted tags":     {2, 0, 0, 0, 0, 0, 0, 0, 'N', 'O', 'N', 'C', 'S', 'I', 'G', 0, 0, 0, 0, 0},
+		"offset overflows":  {2, 0, 0, 0, 8, 0, 0, 0, 'N', 'O', 'N', 'C', 'P', 'A', 'D', 0xff, 0, 0, 0, 0},
+		"unaligned offset":  {2, 0, 0, 0, 2, 0, 0, 0, 'N', 'O', 'N', 'C', 'P', 'A', 'D', 0xff, 0, 0, 0, 0},
+		"header is too big": {3, 0, 0, 0, 0, 0, 0, 0},
+	}
+	for name, b := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := decodeRoughtimeMessage(b); err == nil {
+				t.Error("want error, got nil")
+			}
+		})
+	}
+}
+
+func TestVerifyRoughtimeResponse_MerklePath(t *testing.T) {
+	rootPub, rootKey, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1234567890, 0)
+	d, err := newRoughtimeDelegation(rootKey, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a tree of two nonces; our nonce is the right one.
+	other := bytes.Repeat([]byte{0x01}, roughtimeNonceSize)
+	nonce := bytes.Repeat([]byte{0x02}, roughtimeNonceSize)
+	left := roughtimeHashLeaf(other)
+	root := roughtimeHashNode(left, roughtimeHashLeaf(nonce))
+
+	srep, err := encodeRoughtimeMessage(map[roughtimeTag][]byte{
+		roughtimeTagROOT: root,
+		roughtimeTagMIDP: binary.LittleEndian.AppendUint64(nil, uint64(now.UnixMicro())),
+		roughtimeTagRADI: binary.LittleEndian.AppendUint32(nil, 1000000), // 1 second
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig := ed25519.Sign(d.key, append(append([]byte{}, roughtimeResponseContext...), srep...))
+	res, err := encodeRoughtimeMessage(map[roughtimeTag][]byte{
+		roughtimeTagSIG:  sig,
+		roughtimeTagPATH: left,
+		roughtimeTagSREP: srep,
+		roughtimeTagCERT: d.cert,
+		roughtimeTagINDX: {1, 0, 0, 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	midpoint, radius, err := verifyRoughtimeResponse(res, nonce, rootPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !midpoint.Equal(now) {
+		t.Errorf("unexpected midpoint: want %s, got %s", now, midpoint)
+	}
+	if radius != time.Second {
+		t.Errorf("unexpected radius: want %s, got %s", time.Second, radius)
+	}
+
+	// the other nonce is not at index 1.
+	_, _, err = verifyRoughtimeResponse(res, other, rootPub)
+	var verr *RoughtimeVerificationError
+	if !errors.As(err, &verr) {
+		t.Errorf("want RoughtimeVerificationError, got %v", err)
+	}
+}
+
+func TestGetRoughtime(t *testing.T) {
+	defer func(f func() time.Time) { clientStartTime = f }(clientStartTime)
+	clientStartTime = func() time.Time {
+		return time.Unix(1234567890, 0)
+	}
+	defer func(f func() time.Time) { clientEndTime = f }(clientEndTime)
+	clientEndTime = func() time.Time {
+		return time.Unix(1234567892, 0)
+	}
+
+	pub, key, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Unix(1234567895, 0)
+		}),
+		RoughtimeKey:    key,
+		RoughtimeRadius: 10 * time.Millisecond,
+	}
+	s.Start()
+	defer s.Close()
+	addr, _ := startRoughtimeServer(t, s)
+
+	c := &Client{}
+	result, err := c.Get(context.Background(), "roughtime://"+addr+"?pubkey="+url.QueryEscape(base64.StdEncoding.EncodeToString(pub)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Offset != 4*time.Second {
+		t.Errorf("unexpected offset, want %s, got %s", 4*time.Second, result.Offset)
+	}
+	if result.Delay != 2*time.Second {
+		t.Errorf("unexpected delay, want %s, got %s", 2*time.Second, result.Delay)
+	}
+	if result.Uncertainty != 10*time.Millisecond {
+		t.Errorf("unexpected uncertainty, want %s, got %s", 10*time.Millisecond, result.Uncertainty)
+	}
+
+	// unescaped keys are accepted too.
+	if _, err := c.Get(context.Background(), "roughtime://"+addr+"?pubkey="+base64.StdEncoding.EncodeToString(pub)); err != nil {
+		t.Fatal(err)
+	}
+
+	// look up the key by host.
+	c = &Client{
+		RoughtimeKeys: map[string]ed25519.PublicKey{addr: pub},
+	}
+	if _, err := c.Get(context.Background(), "roughtime://"+addr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetRoughtime_WrongKey(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		RoughtimeKey: key,
+	}
+	s.Start()
+	defer s.Close()
+	addr, _ := startRoughtimeServer(t, s)
+
+	c := &Client{
+		RoughtimeKeys: map[string]ed25519.PublicKey{addr: otherPub},
+	}
+	_, err = c.Get(context.Background(), "roughtime://"+addr)
+	var verr *RoughtimeVerificationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("want RoughtimeVerificationError, got %v", err)
+	}
+}
+
+func TestGetRoughtime_UnknownKey(t *testing.T) {
+	c := &Client{}
+	if _, err := c.Get(context.Background(), "roughtime://127.0.0.1:2002"); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestServer_ServeRoughtime_ShortRequest(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		RoughtimeKey: key,
+	}
+	s.Start()
+	addr, done := startRoughtimeServer(t, s)
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	req, err := encodeRoughtimeMessage(map[roughtimeTag][]byte{
+		roughtimeTagNONC: make([]byte, roughtimeNonceSize),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(req); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 1024)); err == nil {
+		t.Error("the server responds to a short request")
+	}
+
+	s.Close()
+	if err := <-done; !errors.Is(err, net.ErrClosed) {
+		t.Errorf("want net.ErrClosed, got %v", err)
+	}
+}
+
+func TestServer_ServeRoughtime_NoKey(t *testing.T) {
+	s := &Server{}
+	s.Start()
+	defer s.Close()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ServeRoughtime(conn); err == nil {
+		t.Error("want error, got nil")
+	}
+}
@@ -0,0 +1,83 @@
+package webntp
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// WellKnownTimePath is the path of Time over HTTPS.
+// http://phk.freebsd.dk/time/20151129/
+const WellKnownTimePath = "/.well-known/time"
+
+// HTTPSTimeHandler returns a handler that serves Time over HTTPS.
+// It responds to HEAD and GET requests with the X-HTTPSTIME header.
+func (s *Server) HTTPSTimeHandler() http.Handler {
+	return s.handler(func(rw http.ResponseWriter, req *http.Request) {
+		if !allowGet(rw, req) {
+			return
+		}
+		s.serveHTTPSTime(rw, req)
+	})
+}
+
+// JSONHandler returns a handler that serves JSON over HTTP.
+func (s *Server) JSONHandler() http.Handler {
+	return s.handler(s.serveJSON)
+}
+
+// WebSocketHandler returns a handler that serves JSON over WebSocket.
+func (s *Server) WebSocketHandler() http.Handler {
+	return s.handler(s.handleWebsocket)
+}
+
+// Router returns a handler that routes requests by path.
+//
+//   - /.well-known/time: Time over HTTPS
+//   - prefix: JSON over WebSocket for upgrade requests, NTP over HTTP for POST requests of ContentTypeNTP,
+//     otherwise JSON over HTTP
+//   - /cgi-bin/json and /cgi-bin/jsont: JSON and JSONP over HTTP (only if NICTCompatible is true)
+//   - /healthz: the status of the leap seconds list (see HealthHandler)
+//   - /leap-seconds.json: the leap seconds list in JSON (see LeapSecondsHandler)
+//   - /leap-seconds.list: the leap seconds list in the format of leap-seconds.list (see LeapSecondsListHandler)
+//
+// The other paths are responded with 404 Not Found.
+// prefix is the path of the JSON API, e.g. "/api". Empty prefix means the root.
+func (s *Server) Router(prefix string) http.Handler {
+	prefix = "/" + strings.Trim(prefix, "/")
+	api := s.handler(func(rw http.ResponseWriter, req *http.Request) {
+		if websocket.IsWebSocketUpgrade(req) {
+			s.handleWebsocket(rw, req)
+			return
+		}
+		if isNTPRequest(req) {
+			s.serveNTP(rw, req)
+			return
+		}
+		s.serveJSON(rw, req)
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle(WellKnownTimePath, s.HTTPSTimeHandler())
+	mux.Handle(HealthPath, s.HealthHandler())
+	mux.Handle(LeapSecondsJSONPath, s.LeapSecondsHandler())
+	mux.Handle(LeapSecondsListPath, s.LeapSecondsListHandler())
+	if prefix == "/" {
+		mux.Handle("/{$}", api)
+	} else {
+		mux.Handle(prefix, api)
+		mux.Handle(prefix+"/{$}", api)
+	}
+	if s.NICTCompatible {
+		mux.Handle(NICTJSONPath, s.JSONHandler())
+		mux.Handle(NICTJSONPPath, s.JSONHandler())
+	}
+	return mux
+}
+
+func (s *Server) handler(f http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		s.serve(rw, req, f)
+	})
+}
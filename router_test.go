@@ -0,0 +1,117 @@
+package webntp
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestServer_Router(t *testing.T) {
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Unix(1234567891, 0)
+		}),
+	}
+	s.Start()
+	defer s.Close()
+	h := s.Router("/api")
+
+	testCases := []struct {
+		method      string
+		path        string
+		code        int
+		httpsTime   string
+		contentType string
+	}{
+		{http.MethodHead, "/.well-known/time", http.StatusNoContent, "1234567891.000000", ""},
+		{http.MethodGet, "/.well-known/time", http.StatusNoContent, "1234567891.000000", ""},
+		{http.MethodPost, "/.well-known/time", http.StatusMethodNotAllowed, "", "text/plain; charset=utf-8"},
+		{http.MethodGet, "/api?1234567890", http.StatusOK, "", "application/json; charset=utf-8"},
+		{http.MethodGet, "/api/?1234567890", http.StatusOK, "", "application/json; charset=utf-8"},
+		{http.MethodHead, "/api", http.StatusOK, "", "application/json; charset=utf-8"},
+		{http.MethodGet, "/leap-seconds.json", http.StatusOK, "", "application/json; charset=utf-8"},
+		{http.MethodGet, "/leap-seconds.list", http.StatusOK, "", "text/plain; charset=utf-8"},
+		{http.MethodPost, "/leap-seconds.list", http.StatusMethodNotAllowed, "", "text/plain; charset=utf-8"},
+		{http.MethodGet, "/", http.StatusNotFound, "", "text/plain; charset=utf-8"},
+		{http.MethodGet, "/api/foo", http.StatusNotFound, "", "text/plain; charset=utf-8"},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest(tc.method, "http://example.com"+tc.path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("%s %s: unexpected status code: want %d, got %d", tc.method, tc.path, tc.code, w.Code)
+		}
+		if got := w.Header().Get("X-HTTPSTIME"); got != tc.httpsTime {
+			t.Errorf("%s %s: unexpected X-HTTPSTIME: want %q, got %q", tc.method, tc.path, tc.httpsTime, got)
+		}
+		if got := w.Header().Get("Content-Type"); got != tc.contentType {
+			t.Errorf("%s %s: unexpected Content-Type: want %q, got %q", tc.method, tc.path, tc.contentType, got)
+		}
+	}
+}
+
+func TestServer_Router_root(t *testing.T) {
+	s := &Server{}
+	s.Start()
+	defer s.Close()
+	h := s.Router("")
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/?1234567890", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("unexpected status code: want %d, got %d", http.StatusOK, w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unexpected status code: want %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestServer_Router_WebSocket(t *testing.T) {
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Unix(1234567895, 0)
+		}),
+	}
+	s.Start()
+	defer s.Close()
+	ts := httptest.NewServer(s.Router("/api"))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/api"
+	c := &Client{}
+	result, err := c.Get(t.Context(), u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Until(time.Unix(1234567895, 0))
+	if d := result.Offset - want; d < -time.Second || d > time.Second {
+		t.Errorf("unexpected offset: want %s, got %s", want, result.Offset)
+	}
+}
+
+func TestServer_WebSocketHandler(t *testing.T) {
+	s := &Server{
+		Logger: slog.New(slog.DiscardHandler),
+	}
+	s.Start()
+	defer s.Close()
+
+	// plain HTTP requests are rejected.
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	w := httptest.NewRecorder()
+	s.WebSocketHandler().ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unexpected status code: want %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -3,11 +3,14 @@ package webntp
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
 	"strings"
 	"sync"
@@ -17,49 +20,244 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-// serverTime is used by tests.
-var serverTime = time.Now
+// Clock is the source of the current time for the Server.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc is an adapter to allow the use of ordinary functions as Clock.
+type ClockFunc func() time.Time
+
+// Now calls f().
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock is a Clock that returns the system time.
+var SystemClock Clock = ClockFunc(time.Now)
 
 var defaultUpgrader = &websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	Subprotocols:    []string{Subprotocol},
+	Subprotocols:    []string{SubprotocolNTP, Subprotocol},
+}
+
+// smearUpgrader prefers the Subprotocol, because NTP packets are not smeared.
+var smearUpgrader = &websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	Subprotocols:    []string{Subprotocol, SubprotocolNTP},
 }
 
 // Server is a webntp server.
 type Server struct {
+	// Upgrader is the upgrader for WebSocket.
+	// If nil, the default upgrader that applies AllowedOrigins is used.
 	Upgrader *websocket.Upgrader
 
+	// AllowedOrigins is the list of origins allowed to access the server from browsers.
+	// Each entry is "*", an exact origin such as "https://example.com",
+	// or an origin with a wildcard subdomain such as "https://*.example.com".
+	// It is applied to CORS of JSON over HTTP and Time over HTTPS,
+	// and to the origin check of WebSocket (unless Upgrader is set).
+	// If empty, only same-origin WebSocket connections are accepted and no CORS headers are sent.
+	AllowedOrigins []string
+
+	// NICTCompatible enables the compatibility with the http/https time service of NICT.
+	// JSON over HTTP accepts named query parameters "it" and "callback",
+	// and responds JSONP if callback is given.
+	// Router also serves NICTJSONPath and NICTJSONPPath.
+	NICTCompatible bool
+
+	// Clock is the time source of the server.
+	// If nil, SystemClock is used.
+	Clock Clock
+
 	// path for leap-seconds.list cache
+	// The file may be in any format that ParseLeapSeconds supports,
+	// e.g. /usr/share/zoneinfo/leapseconds with empty LeapSecondsURL.
+	// Without LeapSecondsURL and LeapSecondsMirrors, the file takes priority over the embedded list even if it is older.
 	LeapSecondsPath string
 
 	// url for leap-seconds.list
+	// The fetched file must be leap-seconds.list, unlike LeapSecondsPath.
+	// If empty and no LeapSecondsMirrors, the server only reads LeapSecondsPath and never fetches.
 	LeapSecondsURL string
 
-	leapSecondsList atomic.Value
-	ctx             context.Context
-	cancel          context.CancelFunc
-	wg              sync.WaitGroup
+	// LeapSecondsMirrors is the urls of the mirrors of LeapSecondsURL.
+	// The server fetches from LeapSecondsURL and the mirrors in order with conditional requests,
+	// skips the unavailable ones, and uses the newest list among them.
+	LeapSecondsMirrors []string
+
+	// HTTPClient is the client to fetch leap-seconds.list.
+	// If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// LeapSecondsWarning is how long before the expiration of the leap seconds list
+	// the server warns and LeapSecondsStatus reports LeapSecondsStatusWarning.
+	// If zero, 14 days is used.
+	LeapSecondsWarning time.Duration
+
+	// LaxLeapSecondsList disables the hash verification of leap-seconds.list.
+	// By default, the lists with invalid hashes are rejected,
+	// and the server keeps the current list and its cache.
+	LaxLeapSecondsList bool
+
+	// Stratum is the stratum of NTP responses.
+	// If zero, 10 is used, so that NTP clients prefer the real upstreams.
+	// Set it to the stratum of the upstream plus one if the system clock is synchronized.
+	Stratum uint8
+
+	// ReferenceID is the reference identifier of NTP responses, up to 4 ASCII characters.
+	// If empty, "WNTP" is used.
+	ReferenceID string
+
+	// Logger is the logger of the server.
+	// If nil, slog.Default() is used.
+	Logger *slog.Logger
+
+	// RequestRateLimit limits the HTTP requests per client IP address,
+	// and the NTP and Roughtime requests per source address.
+	// IPv6 clients are limited per /64.
+	// The zero value means no limit.
+	RequestRateLimit RateLimit
+
+	// TrustedProxies are the IP addresses or the CIDRs of the reverse proxies and CDNs in front of the server,
+	// e.g. "192.0.2.1" or "10.0.0.0/8".
+	// The requests from them are limited by the client address in X-Forwarded-For.
+	// The header is ignored for the other requests.
+	TrustedProxies []string
+
+	// MessageRateLimit limits the messages per WebSocket connection.
+	// The zero value means no limit.
+	MessageRateLimit RateLimit
+
+	// MaxConcurrency is the maximum number of concurrent requests,
+	// including open WebSocket connections.
+	// If exceeded, the server responds 503 Service Unavailable.
+	// Zero means no limit.
+	MaxConcurrency int
+
+	// LeapSmear is the window of the leap smear, e.g. 24 hours for noon-to-noon smearing.
+	// If positive, JSON over HTTP, JSON over WebSocket and Time over HTTPS serve
+	// the time smeared linearly over the window centered at each leap second,
+	// while the leap second information describes the real event.
+	// NTP and Roughtime are not smeared, so the default Upgrader prefers the Subprotocol to the SubprotocolNTP.
+	LeapSmear time.Duration
+
+	// SigningKey is the Ed25519 private key to sign JSON responses.
+	// If nil, the responses are not signed.
+	SigningKey ed25519.PrivateKey
+
+	// RoughtimeKey is the long-term private key of the Roughtime server.
+	// ServeRoughtime signs delegated keys with it.
+	RoughtimeKey ed25519.PrivateKey
+
+	// RoughtimeRadius is the uncertainty of Roughtime responses.
+	// If zero, one second is used.
+	RoughtimeRadius time.Duration
+
+	leapSecondsList   atomic.Value
+	leapSecondsMu     sync.Mutex // guards storing leapSecondsList and the fields below
+	leapSecondsSource string
+	leapSecondsFile   *leapSecondsFile
+	leapWatchers      []*LeapWatcher
+	lastFetch         time.Time
+	lastFetchErr      error
+
+	fetchMu            sync.Mutex // guards fetching and the fields below
+	leapSecondsMirrors map[string]*leapSecondsMirror
+	brokenCache        bool // LeapSecondsPath is malformed, so the next fetch overwrites it
+
+	metrics        serverMetrics
+	limiter        rateLimiter
+	trustedProxies []netip.Prefix
+	smear          smearState
+	roughtime      roughtimeServer
+	concurrency    atomic.Int64
+	ctx            context.Context
+	cancel         context.CancelFunc
+	wg             sync.WaitGroup
+	background     sync.WaitGroup // the goroutines started by Start
 }
 
 type serverConn struct {
-	s    *Server
-	conn *websocket.Conn
-	host string
-	ch   chan *Response
+	s          *Server
+	conn       *websocket.Conn
+	host       string
+	remoteAddr string
+	binary     bool
+	ch         chan wsMessage
 }
 
+type wsMessage struct {
+	messageType int
+	data        []byte
+}
+
+// ServeHTTP serves all protocols regardless of the path.
+// HEAD requests are Time over HTTPS, WebSocket upgrade requests are JSON over WebSocket,
+// POST requests of ContentTypeNTP are NTP over HTTP, and the others are JSON over HTTP.
+// Use Router to route requests by path.
 func (s *Server) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	s.serve(rw, req, s.serveAny)
+}
+
+// serve calls f with the bookkeeping of the server, load shedding and rate limiting.
+func (s *Server) serve(rw http.ResponseWriter, req *http.Request, f http.HandlerFunc) {
 	s.wg.Add(1)
 	defer s.wg.Done()
+	if !s.admit(rw, req) {
+		return
+	}
+	defer s.release()
+	if s.handleCORS(rw, req) {
+		return
+	}
+	f(rw, req)
+}
+
+// admit applies load shedding and rate limiting.
+// If it returns false, the response has already been written.
+// Otherwise, the caller must call s.release when the request is done.
+func (s *Server) admit(rw http.ResponseWriter, req *http.Request) bool {
+	// load shedding
+	if s.MaxConcurrency > 0 {
+		n := s.concurrency.Add(1)
+		if n > int64(s.MaxConcurrency) {
+			s.concurrency.Add(-1)
+			s.metrics.rejectedOverload.Add(1)
+			rw.Header().Set("Retry-After", retryAfter(time.Second))
+			http.Error(rw, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return false
+		}
+	}
+
+	// rate limit per client
+	if s.RequestRateLimit.enabled() {
+		ok, wait := s.limiter.allow(s.RequestRateLimit, s.requestIP(req), time.Now())
+		if !ok {
+			s.release()
+			s.metrics.rejectedRateLimit.Add(1)
+			rw.Header().Set("Retry-After", retryAfter(wait))
+			http.Error(rw, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return false
+		}
+	}
+	return true
+}
 
+// release releases the resources acquired by s.admit.
+func (s *Server) release() {
+	if s.MaxConcurrency > 0 {
+		s.concurrency.Add(-1)
+	}
+}
+
+func (s *Server) serveAny(rw http.ResponseWriter, req *http.Request) {
 	// Time over HTTPS
-	// /.well-known/time
-	// http://phk.freebsd.dk/time/20151129/#improved-timekeeping-reponse
 	if req.Method == http.MethodHead {
-		b, _ := Timestamp(serverTime()).MarshalJSON()
-		rw.Header().Set("X-HTTPSTIME", string(b))
-		rw.WriteHeader(http.StatusNoContent)
+		s.serveHTTPSTime(rw, req)
 		return
 	}
 
@@ -69,53 +267,92 @@ func (s *Server) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	now := serverTime()
-	leap := s.getLeapSecond(now)
-	start := zeroEpochTime
-	if q := req.URL.RawQuery; q != "" {
-		err := start.UnmarshalJSON([]byte(strings.TrimSpace(q)))
+	// NTP over HTTP
+	if isNTPRequest(req) {
+		s.serveNTP(rw, req)
+		return
+	}
+
+	s.serveJSON(rw, req)
+}
+
+// serveHTTPSTime serves Time over HTTPS.
+// /.well-known/time
+// http://phk.freebsd.dk/time/20151129/#improved-timekeeping-reponse
+func (s *Server) serveHTTPSTime(rw http.ResponseWriter, req *http.Request) {
+	begin := time.Now()
+	now, _ := s.smearedNow()
+	b, _ := Timestamp(now).MarshalJSON()
+	rw.Header().Set("X-HTTPSTIME", string(b))
+	rw.WriteHeader(http.StatusNoContent)
+	s.metrics.observe(protocolHTTPSTime, begin)
+}
+
+// serveJSON serves JSON over HTTP.
+func (s *Server) serveJSON(rw http.ResponseWriter, req *http.Request) {
+	begin := time.Now()
+	q := jsonQuery{it: zeroEpochTime}
+	if raw := req.URL.RawQuery; s.NICTCompatible || strings.Contains(raw, "=") {
+		var err error
+		q, err = parseJSONQuery(raw)
+		if err != nil {
+			http.Error(rw, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+	} else if raw != "" {
+		err := q.it.UnmarshalJSON([]byte(strings.TrimSpace(raw)))
 		if err != nil {
 			return
 		}
 	}
-	res := &Response{
-		ID:           req.Host,
-		InitiateTime: start,
-		SendTime:     Timestamp(now),
-		Time:         Timestamp(now),
-		Leap:         leap.Leap,
-		Next:         Timestamp(leap.At),
-		Step:         leap.Step,
+	var callback string
+	if s.NICTCompatible {
+		callback = q.callback
+		if callback == "" && strings.HasSuffix(req.URL.Path, NICTJSONPPath) {
+			callback = defaultNICTCallback
+		}
+	}
+	res := s.newResponse(req.Host, q.it, q.nonce)
+
+	if callback != "" {
+		writeJSONP(rw, callback, res)
+		s.metrics.observe(protocolJSON, begin)
+		return
 	}
 
 	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
 	rw.Header().Set("Cache-Control", "no-cache, no-store")
 	enc := json.NewEncoder(rw)
 	enc.Encode(res)
+	s.metrics.observe(protocolJSON, begin)
 }
 
 func (s *Server) handleWebsocket(rw http.ResponseWriter, req *http.Request) {
-	upgrader := s.Upgrader
-	if upgrader == nil {
-		upgrader = defaultUpgrader
-	}
-	conn, err := upgrader.Upgrade(rw, req, nil)
+	conn, err := s.upgrader().Upgrade(rw, req, nil)
 	if err != nil {
-		log.Println("upgrade error: ", err)
+		s.logger().Warn("websocket upgrade failed",
+			slog.String("remote_addr", req.RemoteAddr),
+			slog.String("protocol", protocolWebSocket.String()),
+			slog.Any("err", err),
+		)
 		return
 	}
 	defer conn.Close()
+	s.metrics.websocketConnections.Add(1)
+	defer s.metrics.websocketConnections.Add(-1)
 
 	// limit the read buffer size to avoid memory exhaustion.
 	conn.SetReadLimit(1024)
 
-	ch := make(chan *Response, 1)
+	ch := make(chan wsMessage, 1)
 	defer close(ch)
 	c := &serverConn{
-		s:    s,
-		conn: conn,
-		host: req.Host,
-		ch:   ch,
+		s:          s,
+		conn:       conn,
+		host:       req.Host,
+		remoteAddr: req.RemoteAddr,
+		binary:     conn.Subprotocol() == SubprotocolNTP,
+		ch:         ch,
 	}
 
 	go c.handleWrite()
@@ -124,54 +361,163 @@ func (s *Server) handleWebsocket(rw http.ResponseWriter, req *http.Request) {
 
 func (conn *serverConn) handleRead() {
 	ws := conn.conn
+	limit := conn.s.MessageRateLimit
+	var bucket *tokenBucket
+	if limit.enabled() {
+		bucket = newTokenBucket(limit, time.Now())
+	}
 	for {
 		ws.SetReadDeadline(time.Now().Add(time.Minute))
-		_, r, err := ws.NextReader()
+		messageType, r, err := ws.NextReader()
 		if err != nil {
 			if _, ok := err.(*websocket.CloseError); ok {
 				return
 			}
-			log.Println("websocket error: ", err)
+			conn.logError("read", err)
 			return
 		}
+		begin := time.Now()
+		if bucket != nil {
+			if ok, _ := bucket.allow(limit, begin); !ok {
+				conn.s.metrics.rejectedRateLimit.Add(1)
+				ws.WriteControl(
+					websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "rate limit exceeded"),
+					time.Now().Add(time.Second),
+				)
+				return
+			}
+		}
 
 		// parse the request
 		buf, err := io.ReadAll(r)
 		if err != nil {
-			log.Println("websocket error: ", err)
-			return
-		}
-		var start Timestamp
-		err = start.UnmarshalJSON(bytes.TrimSpace(buf))
-		if err != nil {
-			log.Println("websocket error: ", err)
+			conn.logError("read", err)
 			return
 		}
 
 		// send the response
-		now := serverTime()
-		leap := conn.s.getLeapSecond(now)
-		conn.ch <- &Response{
-			ID:           conn.host,
-			InitiateTime: start,
-			SendTime:     Timestamp(now),
-			Time:         Timestamp(now),
-			Leap:         leap.Leap,
-			Next:         Timestamp(leap.At),
-			Step:         leap.Step,
+		if conn.binary {
+			msg, err := conn.ntpMessage(messageType, buf)
+			if err != nil {
+				conn.logError("parse", err)
+				return
+			}
+			conn.ch <- msg
+			conn.s.metrics.observe(protocolWebSocketNTP, begin)
+		} else {
+			msg, err := conn.jsonMessage(buf)
+			if err != nil {
+				conn.logError("parse", err)
+				return
+			}
+			conn.ch <- msg
+			conn.s.metrics.observe(protocolWebSocket, begin)
+		}
+	}
+}
+
+// wsRequest is a request of the Subprotocol with named parameters.
+type wsRequest struct {
+	InitiateTime Timestamp `json:"it"`
+	Nonce        string    `json:"nonce"`
+}
+
+// jsonMessage makes the response of the Subprotocol.
+// The request is a bare timestamp or a JSON object of wsRequest.
+func (conn *serverConn) jsonMessage(buf []byte) (wsMessage, error) {
+	req := wsRequest{InitiateTime: zeroEpochTime}
+	buf = bytes.TrimSpace(buf)
+	if len(buf) > 0 && buf[0] == '{' {
+		if err := json.Unmarshal(buf, &req); err != nil {
+			return wsMessage{}, err
+		}
+		if !validNonce(req.Nonce) {
+			return wsMessage{}, errInvalidNonce
 		}
+	} else if err := req.InitiateTime.UnmarshalJSON(buf); err != nil {
+		return wsMessage{}, err
+	}
+
+	data, err := json.Marshal(conn.s.newResponse(conn.host, req.InitiateTime, req.Nonce))
+	if err != nil {
+		return wsMessage{}, err
 	}
+	return wsMessage{
+		messageType: websocket.TextMessage,
+		data:        append(data, '\n'),
+	}, nil
+}
+
+// newResponse makes the response of JSON over HTTP and WebSocket at the current time.
+// It is signed if the server has SigningKey.
+func (s *Server) newResponse(id string, start Timestamp, nonce string) *Response {
+	now, smearing := s.smearedNow()
+	leap := s.getLeapSecond(now)
+	res := &Response{
+		ID:           id,
+		InitiateTime: start,
+		SendTime:     Timestamp(now),
+		Time:         Timestamp(now),
+		Leap:         leap.Leap,
+		Next:         Timestamp(leap.At),
+		Step:         leap.Step,
+		Smear:        smearing,
+		Stale:        s.leapSecondsStale(now),
+		Nonce:        nonce,
+	}
+	if len(s.SigningKey) == ed25519.PrivateKeySize {
+		res.sign(s.SigningKey)
+	}
+	return res
+}
+
+var errNotBinaryMessage = errors.New("webntp: ntp packets must be sent in binary frames")
+
+// ntpMessage makes the response of the SubprotocolNTP.
+func (conn *serverConn) ntpMessage(messageType int, buf []byte) (wsMessage, error) {
+	recv := conn.s.now()
+	if messageType != websocket.BinaryMessage {
+		return wsMessage{}, errNotBinaryMessage
+	}
+	var req ntpPacket
+	if err := req.UnmarshalBinary(buf); err != nil {
+		return wsMessage{}, err
+	}
+	if req.Mode != ntpModeClient {
+		return wsMessage{}, fmt.Errorf("webntp: unexpected ntp mode: %d", req.Mode)
+	}
+
+	now := conn.s.now()
+	leap := conn.s.getLeapSecond(now)
+	res := conn.s.ntpResponse(&req, recv, now, leap)
+	data := make([]byte, 0, ntpPacketSize+ntpLeapExtensionSize)
+	data = res.appendBinary(data)
+	data = conn.s.ntpLeapExtension(leap, now).appendBinary(data)
+	return wsMessage{
+		messageType: websocket.BinaryMessage,
+		data:        data,
+	}, nil
+}
+
+func (conn *serverConn) logError(kind string, err error) {
+	conn.s.logger().Warn("websocket error",
+		slog.String("remote_addr", conn.remoteAddr),
+		slog.String("protocol", protocolWebSocket.String()),
+		slog.String("kind", kind),
+		slog.Any("err", err),
+	)
 }
 
 func (conn *serverConn) handleWrite() {
 	ws := conn.conn
 	for {
 		select {
-		case response, ok := <-conn.ch:
+		case msg, ok := <-conn.ch:
 			if !ok {
 				return
 			}
-			ws.WriteJSON(response)
+			ws.WriteMessage(msg.messageType, msg.data)
 		case <-conn.s.ctx.Done():
 			ws.WriteControl(
 				websocket.CloseMessage,
@@ -190,13 +536,23 @@ func (s *Server) Start() error {
 	// warm up json encoder.
 	json.Marshal(&Response{})
 
+	proxies, err := parseTrustedProxies(s.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	s.trustedProxies = proxies
+
+	// the embedded list is the last resort.
+	embedded := DefaultLeapSecondsList()
+	s.setLeapSecondsList(embedded, LeapSecondsSourceEmbedded, defaultLeapSecondsList, embedded.UpdateAt)
 	if err := s.readLeapSecondsCache(); err != nil {
 		return err
 	}
-	if s.LeapSecondsURL == "" {
-		return nil
+	if s.LeapSecondsPath != "" {
+		s.startWatchingLeapSeconds()
 	}
-	go s.loopLeapSeconds()
+	s.background.Add(1)
+	go s.loopLeapSeconds(len(s.leapSecondsURLs()) > 0)
 	return nil
 }
 
@@ -204,124 +560,359 @@ func (s *Server) Start() error {
 func (s *Server) Close() error {
 	s.cancel()
 	s.wg.Wait()
+	s.background.Wait()
 	return nil
 }
 
+func (s *Server) now() time.Time {
+	if s.Clock == nil {
+		return SystemClock.Now()
+	}
+	return s.Clock.Now()
+}
+
+func (s *Server) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.Default()
+	}
+	return s.Logger
+}
+
 func (s *Server) getLeapSecond(now time.Time) LeapSecond {
 	list, ok := s.leapSecondsList.Load().(*LeapSecondsList)
-	if !ok {
+	if !ok || len(list.LeapSeconds) == 0 {
 		return LeapSecond{
 			At: time.Time(zeroEpochTime),
 		}
 	}
-	var i int
-	for i = len(list.LeapSeconds); i > 0; i-- {
-		if !now.Before(list.LeapSeconds[i-1].At) {
-			break
-		}
-	}
-	if i == len(list.LeapSeconds) {
-		return list.LeapSeconds[i-1]
-	}
-	return list.LeapSeconds[i]
+	return list.leapSecond(now)
 }
 
+// readLeapSecondsCache reads LeapSecondsPath if any.
+// The malformed file is the lowest priority, so it is logged and the active list is kept.
 func (s *Server) readLeapSecondsCache() error {
 	if s.LeapSecondsPath == "" {
 		return nil
 	}
-
-	f, err := os.Open(s.LeapSecondsPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
+	err := s.ReloadLeapSeconds()
+	var perr *LeapSecondsParseError
+	var herr *LeapSecondsHashError
+	switch {
+	case err == nil, os.IsNotExist(err), errors.Is(err, ErrLeapSecondsNotNewer):
+	case errors.As(err, &perr), errors.As(err, &herr):
+		s.logger().Warn("ignored the malformed leap seconds file",
+			slog.String("path", s.LeapSecondsPath),
+			slog.String("active_source", s.LeapSecondsSource()),
+			slog.Any("err", err),
+		)
+		s.fetchMu.Lock()
+		s.brokenCache = true
+		s.fetchMu.Unlock()
+	default:
 		return err
 	}
-	defer f.Close()
-	list, err := ParseLeapSecondsList(f)
-	if err != nil {
-		return err
+	return nil
+}
+
+// LeapSecondsSourceEmbedded is the source of the leap seconds list embedded in the package.
+const LeapSecondsSourceEmbedded = "embedded"
+
+// LeapSecondsSource returns the source of the active leap seconds list:
+// LeapSecondsSourceEmbedded, LeapSecondsPath or LeapSecondsURL.
+// It returns an empty string before Start.
+func (s *Server) LeapSecondsSource() string {
+	s.leapSecondsMu.Lock()
+	defer s.leapSecondsMu.Unlock()
+	return s.leapSecondsSource
+}
+
+// setLeapSecondsList replaces the active list with list if list is newer.
+// If the server never fetches, LeapSecondsPath is the only source that the user configured,
+// so the list from it replaces the active one even if it is older, e.g. TZif files without the update date.
+// data is the original leap-seconds.list of list that LeapSecondsListHandler serves, or nil for the other formats,
+// and modTime is its modification time.
+// It reports whether the list is replaced.
+func (s *Server) setLeapSecondsList(list *LeapSecondsList, source string, data []byte, modTime time.Time) bool {
+	s.leapSecondsMu.Lock()
+	defer s.leapSecondsMu.Unlock()
+
+	current, ok := s.leapSecondsList.Load().(*LeapSecondsList)
+	if list == current {
+		// e.g. not modified since the last fetch.
+		return false
+	}
+	local := source == s.LeapSecondsPath && len(s.leapSecondsURLs()) == 0
+	if ok && local && (source != s.leapSecondsSource || !list.equal(current)) {
+		if !list.UpdateAt.IsZero() && current.newerThan(list) {
+			s.logger().Warn("the leap seconds file is older than the active list, but it is used",
+				slog.String("source", source),
+				slog.String("active_source", s.leapSecondsSource),
+				slog.Time("update_at", list.UpdateAt),
+				slog.Time("active_update_at", current.UpdateAt),
+			)
+		}
+	} else if ok && !list.newerThan(current) {
+		if !current.newerThan(list) {
+			// the same list, e.g. the cache written by the server.
+			return false
+		}
+		s.logger().Info("ignored the leap seconds list not newer than the active one",
+			slog.String("source", source),
+			slog.String("active_source", s.leapSecondsSource),
+			slog.Time("update_at", list.UpdateAt),
+			slog.Time("expire_at", list.ExpireAt),
+		)
+		return false
 	}
 	s.leapSecondsList.Store(list)
-	return nil
+	s.leapSecondsSource = source
+	s.leapSecondsFile = newLeapSecondsFile(list, data, modTime)
+	for _, w := range s.leapWatchers {
+		w.Update(list)
+	}
+	if ok {
+		s.logger().Info("updated the leap seconds list",
+			slog.String("source", source),
+			slog.Time("update_at", list.UpdateAt),
+			slog.Time("expire_at", list.ExpireAt),
+		)
+	}
+	return true
 }
 
-func (s *Server) loopLeapSeconds() {
-	err := s.checkAndFetch(s.ctx, time.Now())
-	if err != nil {
-		log.Println(err)
+// AddLeapWatcher makes w follow the active leap seconds list of the server.
+// w is updated with the current list immediately, and whenever the list is replaced.
+func (s *Server) AddLeapWatcher(w *LeapWatcher) {
+	s.leapSecondsMu.Lock()
+	defer s.leapSecondsMu.Unlock()
+	s.leapWatchers = append(s.leapWatchers, w)
+	if list, ok := s.leapSecondsList.Load().(*LeapSecondsList); ok {
+		w.Update(list)
 	}
-	timer := time.NewTimer(24 * time.Hour)
-	defer timer.Stop()
+}
+
+// parseLeapSecondsFile parses LeapSecondsPath in any format that ParseLeapSeconds supports.
+// The fetched lists are parsed only as leap-seconds.list, so that their hashes are always verified.
+func (s *Server) parseLeapSecondsFile(r io.Reader) (*LeapSecondsList, error) {
+	return parseLeapSeconds(r, s.LaxLeapSecondsList)
+}
+
+const (
+	// leapSecondsCheckInterval is the interval to check the leap seconds list.
+	leapSecondsCheckInterval = 24 * time.Hour
+
+	// leapSecondsRefreshBefore is how long before the expiration the server starts fetching.
+	leapSecondsRefreshBefore = 30 * 24 * time.Hour
+
+	// leapSecondsRetryMin is the first retry interval after a failure.
+	// It doubles on each failure up to leapSecondsCheckInterval.
+	leapSecondsRetryMin = time.Minute
+
+	// leapSecondsFetchTimeout is the timeout to fetch from one mirror.
+	leapSecondsFetchTimeout = time.Minute
+)
+
+// loopLeapSeconds checks the leap seconds list periodically.
+// If fetch is true, it also fetches the new list.
+func (s *Server) loopLeapSeconds(fetch bool) {
+	defer s.background.Done()
+
+	var failures int
 	for {
-		select {
-		case now := <-timer.C:
-			err := s.checkAndFetch(s.ctx, now)
-			if err != nil {
-				log.Println(err)
+		delay := leapSecondsCheckInterval
+		now := time.Now()
+		if fetch {
+			if err := s.checkAndFetch(s.ctx, now); err != nil {
+				s.logFetchError(err)
+				failures++
+				delay = leapSecondsRetryDelay(failures)
+			} else {
+				failures = 0
 			}
+		}
+		s.warnLeapSecondsExpiry(now)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
 		case <-s.ctx.Done():
+			timer.Stop()
 			return
 		}
 	}
 }
 
-// checkAndFetch checks the leap seconds list is expired,
+// leapSecondsRetryDelay returns the delay before the next fetch after the consecutive failures.
+func leapSecondsRetryDelay(failures int) time.Duration {
+	delay := leapSecondsRetryMin
+	for i := 1; i < failures && delay < leapSecondsCheckInterval; i++ {
+		delay *= 2
+	}
+	return min(delay, leapSecondsCheckInterval)
+}
+
+func (s *Server) logFetchError(err error) {
+	s.logger().Error("failed to fetch leap-seconds.list",
+		slog.Any("urls", s.leapSecondsURLs()),
+		slog.Any("err", err),
+	)
+}
+
+// leapSecondsURLs returns LeapSecondsURL and LeapSecondsMirrors in order.
+func (s *Server) leapSecondsURLs() []string {
+	urls := make([]string, 0, 1+len(s.LeapSecondsMirrors))
+	if s.LeapSecondsURL != "" {
+		urls = append(urls, s.LeapSecondsURL)
+	}
+	return append(urls, s.LeapSecondsMirrors...)
+}
+
+func (s *Server) httpClient() *http.Client {
+	if s.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return s.HTTPClient
+}
+
+// checkAndFetch checks the leap seconds list is expiring,
 // and fetch new list if needed.
 func (s *Server) checkAndFetch(ctx context.Context, now time.Time) error {
 	list, ok := s.leapSecondsList.Load().(*LeapSecondsList)
-	if !ok || now.After(list.ExpireAt) {
-		log.Printf("fetch %s", s.LeapSecondsURL)
-		ctx, cancel := context.WithTimeout(ctx, time.Minute)
-		defer cancel()
+	if !ok || now.After(list.ExpireAt.Add(-leapSecondsRefreshBefore)) {
+		s.logger().Info("fetching leap-seconds.list", slog.Any("urls", s.leapSecondsURLs()))
 		err := s.fetchLeapSeconds(ctx)
+		s.recordFetch(now, err)
 		if err != nil {
+			s.metrics.leapSecondsFetchFailure.Add(1)
 			return err
 		}
+		s.metrics.leapSecondsFetchSuccess.Add(1)
 	}
 	return nil
 }
 
+// leapSecondsMirror is the last response from a mirror, for conditional requests.
+type leapSecondsMirror struct {
+	etag         string
+	lastModified string
+	modTime      time.Time // Last-Modified, or the time of the fetch without it
+	data         []byte
+	list         *LeapSecondsList
+}
+
+// fetchLeapSeconds fetches the lists from all the mirrors, and uses the newest one.
+// It fails only if no mirror is available.
 func (s *Server) fetchLeapSeconds(ctx context.Context) error {
-	// open cache file
-	name := fmt.Sprintf("%s.%d", s.LeapSecondsPath, time.Now().Unix())
-	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
+	s.fetchMu.Lock()
+	defer s.fetchMu.Unlock()
+
+	var best *leapSecondsMirror
+	var source string
+	var errs []error
+	for _, u := range s.leapSecondsURLs() {
+		m, err := s.fetchLeapSecondsMirror(ctx, u)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", u, err))
+			continue
+		}
+		if best == nil || m.list.newerThan(best.list) {
+			best, source = m, u
+		}
+	}
+	if best == nil {
+		return errors.Join(errs...)
+	}
+	for _, err := range errs {
+		s.logger().Warn("failed to fetch leap-seconds.list from a mirror", slog.Any("err", err))
+	}
+
+	if !s.setLeapSecondsList(best.list, source, best.data, best.modTime) && !s.brokenCache {
+		// keep the cache of the active list.
+		return nil
+	}
+	if err := s.writeLeapSecondsCache(best.data, best.modTime); err != nil {
 		return err
 	}
-	defer func() {
-		f.Close()
-		os.Remove(name)
-	}()
+	s.brokenCache = false
+	return nil
+}
+
+// fetchLeapSecondsMirror fetches the list from u.
+// If the list is not modified since the last fetch, it returns the last one.
+func (s *Server) fetchLeapSecondsMirror(ctx context.Context, u string) (*leapSecondsMirror, error) {
+	ctx, cancel := context.WithTimeout(ctx, leapSecondsFetchTimeout)
+	defer cancel()
 
-	// get the new list.
-	req, err := http.NewRequest(http.MethodGet, s.LeapSecondsURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	req = req.WithContext(ctx)
-	resp, err := http.DefaultClient.Do(req)
+	last := s.leapSecondsMirrors[u]
+	if last != nil {
+		if last.etag != "" {
+			req.Header.Set("If-None-Match", last.etag)
+		}
+		if last.lastModified != "" {
+			req.Header.Set("If-Modified-Since", last.lastModified)
+		}
+	}
+	resp, err := s.httpClient().Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	// write to cache, and parse it.
-	r := io.TeeReader(resp.Body, f)
-	list, err := ParseLeapSecondsList(r)
+	switch {
+	case resp.StatusCode == http.StatusNotModified && last != nil:
+		return last, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	data, err := readLeapSeconds(resp.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	s.leapSecondsList.Store(list)
+	list, err := parseLeapSecondsList(bytes.NewReader(data), s.LaxLeapSecondsList)
+	if err != nil {
+		return nil, err
+	}
+
+	modTime, err := http.ParseTime(resp.Header.Get("Last-Modified"))
+	if err != nil {
+		modTime = time.Now()
+	}
+	m := &leapSecondsMirror{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		modTime:      modTime,
+		data:         data,
+		list:         list,
+	}
+	if s.leapSecondsMirrors == nil {
+		s.leapSecondsMirrors = make(map[string]*leapSecondsMirror)
+	}
+	s.leapSecondsMirrors[u] = m
+	return m, nil
+}
 
-	// update cache file
-	if err := f.Close(); err != nil {
+// writeLeapSecondsCache replaces the cache file with data atomically.
+// The modification time of the file is set to modTime,
+// so that LeapSecondsListHandler serves the same Last-Modified after restarts.
+func (s *Server) writeLeapSecondsCache(data []byte, modTime time.Time) error {
+	if s.LeapSecondsPath == "" {
+		return nil
+	}
+	name := fmt.Sprintf("%s.%d", s.LeapSecondsPath, time.Now().Unix())
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Chtimes(name, modTime, modTime); err != nil {
+		os.Remove(name)
 		return err
 	}
 	if err := os.Rename(name, s.LeapSecondsPath); err != nil {
+		os.Remove(name)
 		return err
 	}
-
 	return nil
 }
@@ -1,11 +1,18 @@
 package webntp
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,12 +21,11 @@ import (
 )
 
 func TestServer_TimeOverHTTPS(t *testing.T) {
-	defer func(f func() time.Time) { serverTime = f }(serverTime)
-	serverTime = func() time.Time {
-		return time.Unix(1234567891, 123123000)
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Unix(1234567891, 123123000)
+		}),
 	}
-
-	s := &Server{}
 	s.Start()
 	defer s.Close()
 
@@ -34,12 +40,11 @@ func TestServer_TimeOverHTTPS(t *testing.T) {
 }
 
 func TestServer_ServeHTTP(t *testing.T) {
-	defer func(f func() time.Time) { serverTime = f }(serverTime)
-	serverTime = func() time.Time {
-		return time.Unix(1234567891, 0)
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Unix(1234567891, 0)
+		}),
 	}
-
-	s := &Server{}
 	s.Start()
 	defer s.Close()
 
@@ -48,9 +53,9 @@ func TestServer_ServeHTTP(t *testing.T) {
 		"it":   1234567890.0,
 		"st":   1234567891.0,
 		"time": 1234567891.0,
-		"leap": 0.0,
-		"next": 0.0,
-		"step": 0.0,
+		"leap": 34.0,         // from the embedded list
+		"next": 1341100800.0, // next leap second is on 2012-07-01
+		"step": 1.0,
 	}
 	testServeHTTP(t, s, 1234567890.0, want)
 	testServeWebSocket(t, s, 1234567890.0, want)
@@ -58,12 +63,10 @@ func TestServer_ServeHTTP(t *testing.T) {
 
 func TestServer_ServeHTTP_with_leap(t *testing.T) {
 	now := time.Now()
-	defer func(f func() time.Time) { serverTime = f }(serverTime)
-	serverTime = func() time.Time {
-		return now
-	}
-
 	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return now
+		}),
 		LeapSecondsPath: "testdata/leap-seconds-2019-05-02.list",
 	}
 	s.Start()
@@ -182,6 +185,56 @@ func testServeWebSocket(t *testing.T, s *Server, it float64, want map[string]int
 	}
 }
 
+func TestServer_Logger(t *testing.T) {
+	var buf bytes.Buffer
+	s := &Server{
+		Logger: slog.New(slog.NewJSONHandler(&buf, nil)),
+	}
+	s.Start()
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	dialer := &websocket.Dialer{
+		Subprotocols: []string{Subprotocol},
+	}
+	conn, _, err := dialer.Dial(u.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("invalid timestamp")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server closes the connection on a parse error.
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Fatal("want error, got nil")
+	}
+	s.Close()
+
+	// find the log of the websocket error.
+	var got map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for got["msg"] != "websocket error" {
+		got = nil
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got["kind"] != "parse" {
+		t.Errorf("unexpected kind: %v", got["kind"])
+	}
+	if got["protocol"] != "websocket" {
+		t.Errorf("unexpected protocol: %v", got["protocol"])
+	}
+	if got["remote_addr"] == "" {
+		t.Error("remote_addr is empty")
+	}
+}
+
 func BenchmarkServeHTTP(b *testing.B) {
 	s := &Server{
 		LeapSecondsPath: "leap-seconds.list",
@@ -208,3 +261,449 @@ func BenchmarkTimeOverHTTPS(b *testing.B) {
 		s.ServeHTTP(w, req)
 	}
 }
+
+// reissueLeapSecondsList returns testdata/leap-seconds-2019-05-02.list reissued with the dates.
+func reissueLeapSecondsList(t *testing.T, updateAt, expireAt time.Time) []byte {
+	t.Helper()
+	f, err := os.Open("testdata/leap-seconds-2019-05-02.list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	list, err := ParseLeapSecondsList(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list.UpdateAt, list.ExpireAt = updateAt, expireAt
+	var buf bytes.Buffer
+	if _, err := list.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestServer_FetchLeapSeconds_InvalidHash(t *testing.T) {
+	// newer than the embedded list.
+	updateAt := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	data := reissueLeapSecondsList(t, updateAt, time.Date(2030, time.December, 28, 0, 0, 0, 0, time.UTC))
+	tampered := reissueLeapSecondsList(t, updateAt, time.Date(2031, time.June, 28, 0, 0, 0, 0, time.UTC))
+	tampered = bytes.Replace(tampered, []byte("3692217600\t37"), []byte("#"), 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write(tampered)
+	}))
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "leap-seconds.list")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		LeapSecondsPath: path,
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.LeapSecondsURL = ts.URL
+	list := s.leapSecondsList.Load().(*LeapSecondsList)
+	if got := s.LeapSecondsSource(); got != path {
+		t.Errorf("unexpected source: want %s, got %s", path, got)
+	}
+
+	// the list has been expired. fetch the new one.
+	err := s.checkAndFetch(context.Background(), list.ExpireAt.Add(time.Second))
+	var herr *LeapSecondsHashError
+	if !errors.As(err, &herr) {
+		t.Fatalf("want LeapSecondsHashError, got %v", err)
+	}
+	if s.leapSecondsList.Load().(*LeapSecondsList) != list {
+		t.Error("the list is replaced")
+	}
+	cache, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cache, data) {
+		t.Error("the cache is replaced")
+	}
+
+	// lax mode accepts it.
+	s.LaxLeapSecondsList = true
+	if err := s.checkAndFetch(context.Background(), list.ExpireAt.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.leapSecondsList.Load().(*LeapSecondsList); len(got.LeapSeconds) != len(list.LeapSeconds)-1 {
+		t.Errorf("unexpected length of the list: %d", len(got.LeapSeconds))
+	}
+	if got := s.LeapSecondsSource(); got != ts.URL {
+		t.Errorf("unexpected source: want %s, got %s", ts.URL, got)
+	}
+}
+
+func TestServer_EmbeddedLeapSeconds(t *testing.T) {
+	var data []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write(data)
+	}))
+	defer ts.Close()
+
+	// no cache, and the URL is unreachable.
+	s := &Server{
+		LeapSecondsPath: filepath.Join(t.TempDir(), "leap-seconds.list"),
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.LeapSecondsURL = ts.URL
+	if got := s.LeapSecondsSource(); got != LeapSecondsSourceEmbedded {
+		t.Errorf("unexpected source: want %s, got %s", LeapSecondsSourceEmbedded, got)
+	}
+	embedded := s.leapSecondsList.Load().(*LeapSecondsList)
+	if diff := cmp.Diff(DefaultLeapSecondsList(), embedded); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// the older list doesn't replace the embedded one.
+	data, err := os.ReadFile("testdata/leap-seconds-2019-05-02.list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := embedded.ExpireAt.Add(time.Second)
+	if err := s.checkAndFetch(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if s.leapSecondsList.Load().(*LeapSecondsList) != embedded || s.LeapSecondsSource() != LeapSecondsSourceEmbedded {
+		t.Error("the embedded list is replaced")
+	}
+	if _, err := os.Stat(s.LeapSecondsPath); !os.IsNotExist(err) {
+		t.Errorf("the cache is written: %v", err)
+	}
+
+	// the newer one does.
+	data = reissueLeapSecondsList(t, embedded.UpdateAt, embedded.ExpireAt.AddDate(0, 6, 0))
+	if err := s.checkAndFetch(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.LeapSecondsSource(); got != ts.URL {
+		t.Errorf("unexpected source: want %s, got %s", ts.URL, got)
+	}
+	cache, err := os.ReadFile(s.LeapSecondsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cache, data) {
+		t.Error("the cache is not written")
+	}
+}
+
+func TestServer_TruncatedLeapSecondsCache(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write(defaultLeapSecondsList)
+	}))
+	defer ts.Close()
+
+	// e.g. the disk was full.
+	path := filepath.Join(t.TempDir(), "leap-seconds.list")
+	if err := os.WriteFile(path, defaultLeapSecondsList[:len(defaultLeapSecondsList)/3], 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		LeapSecondsPath: path,
+		LeapSecondsURL:  ts.URL,
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := s.LeapSecondsSource(); got != LeapSecondsSourceEmbedded && got != ts.URL {
+		t.Errorf("unexpected source: %s", got)
+	}
+
+	// the embedded list has been expired, so the server fetches the same one at once,
+	// and overwrites the broken cache with it.
+	waitFor(t, func() bool {
+		cache, err := os.ReadFile(path)
+		return err == nil && bytes.Equal(cache, defaultLeapSecondsList)
+	})
+}
+
+func TestServer_FetchLeapSeconds_HTML(t *testing.T) {
+	// e.g. captive portals
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "text/html")
+		fmt.Fprintln(rw, "<!DOCTYPE html>\n<html><body>Please log in</body></html>")
+	}))
+	defer ts.Close()
+
+	s := &Server{
+		LeapSecondsPath: filepath.Join(t.TempDir(), "leap-seconds.list"),
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.LeapSecondsURL = ts.URL
+
+	err := s.checkAndFetch(context.Background(), time.Now())
+	var perr *LeapSecondsParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("want LeapSecondsParseError, got %v", err)
+	}
+	if perr.Line != 1 {
+		t.Errorf("want line 1, got %d", perr.Line)
+	}
+	if _, err := os.Stat(s.LeapSecondsPath); !os.IsNotExist(err) {
+		t.Errorf("the cache is written: %v", err)
+	}
+}
+
+func TestServer_FetchLeapSeconds_TZData(t *testing.T) {
+	// the other formats have no hashes, so they are accepted only from LeapSecondsPath.
+	data, err := os.ReadFile("testdata/leapseconds-2025b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write(data)
+	}))
+	defer ts.Close()
+
+	s := &Server{
+		LeapSecondsPath: filepath.Join(t.TempDir(), "leap-seconds.list"),
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.LeapSecondsURL = ts.URL
+
+	err = s.checkAndFetch(context.Background(), time.Now())
+	var perr *LeapSecondsParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("want LeapSecondsParseError, got %v", err)
+	}
+	if got := s.LeapSecondsSource(); got != LeapSecondsSourceEmbedded {
+		t.Errorf("unexpected source: want %s, got %s", LeapSecondsSourceEmbedded, got)
+	}
+	if _, err := os.Stat(s.LeapSecondsPath); !os.IsNotExist(err) {
+		t.Errorf("the cache is written: %v", err)
+	}
+}
+
+func TestServer_TZDataLeapSeconds(t *testing.T) {
+	for _, path := range []string{"testdata/leapseconds-2025b", "testdata/right-UTC-2025b"} {
+		t.Run(path, func(t *testing.T) {
+			s := &Server{
+				Clock: ClockFunc(func() time.Time {
+					return time.Date(2016, time.December, 31, 23, 59, 59, 0, time.UTC)
+				}),
+				LeapSecondsPath: path,
+			}
+			if err := s.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if got := s.LeapSecondsSource(); got != path {
+				t.Errorf("unexpected source: want %s, got %s", path, got)
+			}
+			want := map[string]interface{}{
+				"id":   "example.com",
+				"it":   1234567890.0,
+				"st":   1483228799.0, // 2016-12-31T23:59:59Z
+				"time": 1483228799.0, // 2016-12-31T23:59:59Z
+				"leap": 36.0,
+				"next": 1483228800.0, // next leap second is on 2017-01-01
+				"step": 1.0,
+			}
+			testServeHTTP(t, s, 1234567890.0, want)
+		})
+	}
+}
+
+func TestServer_BulletinCLeapSeconds(t *testing.T) {
+	path := "testdata/bulletinc-57.txt"
+	s := &Server{
+		LeapSecondsPath: path,
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := s.LeapSecondsSource(); got != path {
+		t.Errorf("unexpected source: want %s, got %s", path, got)
+	}
+
+	// the leap seconds before the bulletin are served, too.
+	list, _ := s.activeLeapSeconds()
+	if got := list.TAIMinusUTC(time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)); got != 32 {
+		t.Errorf("TAIMinusUTC: want 32, got %d", got)
+	}
+	rw := httptest.NewRecorder()
+	s.LeapSecondsListHandler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, LeapSecondsListPath, nil))
+	for _, line := range []string{"2272060800\t10\t", "3692217600\t37\t"} {
+		if !strings.Contains(rw.Body.String(), line) {
+			t.Errorf("want %q in:\n%s", line, rw.Body.String())
+		}
+	}
+}
+
+func TestServer_FetchLeapSeconds_Mirrors(t *testing.T) {
+	older, err := os.ReadFile("testdata/leap-seconds-2019-05-02.list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newer := reissueLeapSecondsList(t, time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2030, time.December, 28, 0, 0, 0, 0, time.UTC))
+	serve := func(data []byte) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Write(data)
+		}))
+	}
+	broken := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		http.Error(rw, "oops", http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	olderMirror := serve(older)
+	defer olderMirror.Close()
+	newerMirror := serve(newer)
+	defer newerMirror.Close()
+
+	s := &Server{
+		LeapSecondsPath: filepath.Join(t.TempDir(), "leap-seconds.list"),
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.LeapSecondsURL = broken.URL
+	s.LeapSecondsMirrors = []string{down.URL, newerMirror.URL, olderMirror.URL}
+
+	if err := s.fetchLeapSeconds(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.LeapSecondsSource(); got != newerMirror.URL {
+		t.Errorf("unexpected source: want %s, got %s", newerMirror.URL, got)
+	}
+	cache, err := os.ReadFile(s.LeapSecondsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cache, newer) {
+		t.Error("the cache is not the newest list")
+	}
+
+	// all mirrors are unavailable.
+	s.LeapSecondsMirrors = []string{down.URL}
+	err = s.fetchLeapSeconds(context.Background())
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+	for _, u := range []string{broken.URL, down.URL} {
+		if !strings.Contains(err.Error(), u) {
+			t.Errorf("the error doesn't contain %s: %v", u, err)
+		}
+	}
+	if got := s.LeapSecondsSource(); got != newerMirror.URL {
+		t.Errorf("unexpected source: want %s, got %s", newerMirror.URL, got)
+	}
+}
+
+func TestServer_FetchLeapSeconds_NotModified(t *testing.T) {
+	const etag = `"v1"`
+	const lastModified = "Wed, 08 Jul 2026 00:00:00 GMT"
+	data := reissueLeapSecondsList(t, time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2030, time.December, 28, 0, 0, 0, 0, time.UTC))
+	var downloads, requests int
+	var header http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		header = req.Header.Clone()
+		if req.Header.Get("If-None-Match") == etag {
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		rw.Header().Set("ETag", etag)
+		rw.Header().Set("Last-Modified", lastModified)
+		rw.Write(data)
+	}))
+	defer ts.Close()
+
+	s := &Server{
+		HTTPClient: ts.Client(),
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.LeapSecondsURL = ts.URL
+
+	for i := 0; i < 3; i++ {
+		if err := s.fetchLeapSeconds(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if requests != 3 || downloads != 1 {
+		t.Errorf("want 3 requests and 1 download, got %d requests and %d downloads", requests, downloads)
+	}
+	if got := header.Get("If-None-Match"); got != etag {
+		t.Errorf("unexpected If-None-Match: %q", got)
+	}
+	if got := header.Get("If-Modified-Since"); got != lastModified {
+		t.Errorf("unexpected If-Modified-Since: %q", got)
+	}
+	if got := s.LeapSecondsSource(); got != ts.URL {
+		t.Errorf("unexpected source: want %s, got %s", ts.URL, got)
+	}
+}
+
+func TestServer_CheckAndFetch_BeforeExpiry(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		http.Error(rw, "oops", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	s := &Server{}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.LeapSecondsURL = ts.URL
+	expireAt := s.leapSecondsList.Load().(*LeapSecondsList).ExpireAt
+
+	if err := s.checkAndFetch(context.Background(), expireAt.Add(-leapSecondsRefreshBefore-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 0 {
+		t.Errorf("want no request, got %d", requests)
+	}
+	if err := s.checkAndFetch(context.Background(), expireAt.Add(-leapSecondsRefreshBefore+time.Second)); err == nil {
+		t.Error("want error, got nil")
+	}
+	if requests != 1 {
+		t.Errorf("want 1 request, got %d", requests)
+	}
+}
+
+func TestLeapSecondsRetryDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{10, 512 * time.Minute},
+		{11, 1024 * time.Minute},
+		{12, 24 * time.Hour},
+		{1000, 24 * time.Hour},
+	}
+	for _, tc := range tests {
+		if got := leapSecondsRetryDelay(tc.failures); got != tc.want {
+			t.Errorf("%d failures: want %s, got %s", tc.failures, tc.want, got)
+		}
+	}
+}
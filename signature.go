@@ -0,0 +1,112 @@
+package webntp
+
+import (
+	"crypto/ed25519"
+	crand "crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strconv"
+)
+
+// signatureContext is the prefix of signed messages.
+// It separates the signatures of webntp from the other usages of the same key.
+const signatureContext = "webntp signature v1\n"
+
+// maxNonceLength is the maximum length of nonces.
+const maxNonceLength = 64
+
+var errInvalidNonce = errors.New("webntp: invalid nonce")
+
+var errUnsignedProtocol = errors.New("webntp: the protocol doesn't support signed responses")
+
+// SignatureError is the error returned when a response is not signed by any trusted key.
+type SignatureError struct {
+	Reason string
+}
+
+func (e *SignatureError) Error() string {
+	return "webntp: signature verification failed: " + e.Reason
+}
+
+// signedMessage returns the canonical form of res to be signed.
+// It is the lines of id, it, st, leap, next, step, smear, stale and nonce, following signatureContext.
+func (res *Response) signedMessage() []byte {
+	b := make([]byte, 0, 128)
+	b = append(b, signatureContext...)
+	b = append(b, res.ID...)
+	b = append(b, '\n')
+	b = appendTimestamp(b, res.InitiateTime)
+	b = append(b, '\n')
+	b = appendTimestamp(b, res.SendTime)
+	b = append(b, '\n')
+	b = strconv.AppendInt(b, int64(res.Leap), 10)
+	b = append(b, '\n')
+	b = appendTimestamp(b, res.Next)
+	b = append(b, '\n')
+	b = strconv.AppendInt(b, int64(res.Step), 10)
+	b = append(b, '\n')
+	b = strconv.AppendBool(b, res.Smear)
+	b = append(b, '\n')
+	b = strconv.AppendBool(b, res.Stale)
+	b = append(b, '\n')
+	b = append(b, res.Nonce...)
+	return b
+}
+
+func appendTimestamp(b []byte, t Timestamp) []byte {
+	ts, _ := t.MarshalJSON()
+	return append(b, ts...)
+}
+
+// sign signs res with key.
+func (res *Response) sign(key ed25519.PrivateKey) {
+	sig := ed25519.Sign(key, res.signedMessage())
+	res.Signature = base64.StdEncoding.EncodeToString(sig)
+}
+
+// verify verifies the signature of res with keys, and checks that res is the response to nonce.
+func (res *Response) verify(keys []ed25519.PublicKey, nonce string) error {
+	if res.Signature == "" {
+		return &SignatureError{Reason: "the response is not signed"}
+	}
+	if res.Nonce != nonce {
+		return &SignatureError{Reason: "nonce mismatch"}
+	}
+	sig, err := base64.StdEncoding.DecodeString(res.Signature)
+	if err != nil {
+		return &SignatureError{Reason: "malformed signature"}
+	}
+	msg := res.signedMessage()
+	for _, key := range keys {
+		if ed25519.Verify(key, msg, sig) {
+			return nil
+		}
+	}
+	return &SignatureError{Reason: "the response is not signed by any trusted key"}
+}
+
+// newNonce returns a random nonce.
+func newNonce() (string, error) {
+	var b [24]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:]), nil
+}
+
+// validNonce reports whether nonce is acceptable.
+// It accepts up to maxNonceLength characters of base64 (both standard and URL-safe).
+func validNonce(nonce string) bool {
+	if len(nonce) > maxNonceLength {
+		return false
+	}
+	for _, c := range []byte(nonce) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '+' || c == '/' || c == '-' || c == '_' || c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
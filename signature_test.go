@@ -0,0 +1,215 @@
+package webntp
+
+import (
+	"context"
+	"crypto/ed25519"
+	crand "crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestResponse_Verify(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newResponse := func() *Response {
+		res := &Response{
+			ID:           "example.com",
+			InitiateTime: Timestamp(time.Unix(1234567890, 0)),
+			SendTime:     Timestamp(time.Unix(1234567891, 123456000)),
+			Leap:         34,
+			Next:         Timestamp(time.Unix(1230768000, 0)),
+			Step:         1,
+			Nonce:        "nonce",
+		}
+		res.sign(key)
+		return res
+	}
+
+	if err := newResponse().verify([]ed25519.PublicKey{otherPub, pub}, "nonce"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		modify func(res *Response)
+		keys   []ed25519.PublicKey
+		nonce  string
+	}{
+		"unsigned": {
+			modify: func(res *Response) { res.Signature = "" },
+		},
+		"malformed signature": {
+			modify: func(res *Response) { res.Signature = "!" },
+		},
+		"untrusted key": {
+			keys: []ed25519.PublicKey{otherPub},
+		},
+		"replayed": {
+			nonce: "another nonce",
+		},
+		"id":   {modify: func(res *Response) { res.ID = "example.org" }},
+		"it":   {modify: func(res *Response) { res.InitiateTime = Timestamp(time.Unix(1234567880, 0)) }},
+		"st":   {modify: func(res *Response) { res.SendTime = Timestamp(time.Unix(1234567891, 123457000)) }},
+		"leap": {modify: func(res *Response) { res.Leap = 35 }},
+		"next": {modify: func(res *Response) { res.Next = Timestamp(time.Unix(1341100800, 0)) }},
+		"step": {modify: func(res *Response) { res.Step = -1 }},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			res := newResponse()
+			if tc.modify != nil {
+				tc.modify(res)
+			}
+			keys := tc.keys
+			if keys == nil {
+				keys = []ed25519.PublicKey{pub}
+			}
+			nonce := tc.nonce
+			if nonce == "" {
+				nonce = "nonce"
+			}
+			err := res.verify(keys, nonce)
+			var serr *SignatureError
+			if !errors.As(err, &serr) {
+				t.Errorf("want SignatureError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestResponse_Verify_RoundTrip(t *testing.T) {
+	// the signature survives the JSON encoding.
+	pub, key, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := &Response{
+		ID:       "example.com",
+		SendTime: Timestamp(time.Unix(1234567890, 999999999)),
+		Nonce:    "nonce",
+	}
+	res.sign(key)
+	b, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Response
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if err := got.verify([]ed25519.PublicKey{pub}, "nonce"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGet_Signed(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return time.Unix(1234567895, 0)
+		}),
+		SigningKey: key,
+	}
+	s.Start()
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	c := &Client{
+		TrustedKeys: []ed25519.PublicKey{pub},
+	}
+	for _, u := range []string{ts.URL, ts.URL + "/?1234567890", wsURL} {
+		if _, err := c.Get(context.Background(), u); err != nil {
+			t.Errorf("%s: %v", u, err)
+		}
+	}
+
+	// NTP cannot be signed.
+	if _, err := c.Get(context.Background(), "ntp+"+ts.URL); !errors.Is(err, errUnsignedProtocol) {
+		t.Errorf("want errUnsignedProtocol, got %v", err)
+	}
+}
+
+func TestGet_Signed_Untrusted(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, _, err := ed25519.GenerateKey(crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, s := range map[string]*Server{
+		"unsigned":    {},
+		"another key": {SigningKey: key},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s.Start()
+			defer s.Close()
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+			wsURL := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+			c := &Client{
+				TrustedKeys: []ed25519.PublicKey{pub},
+			}
+			for _, u := range []string{ts.URL, wsURL} {
+				_, err := c.Get(context.Background(), u)
+				var serr *SignatureError
+				if !errors.As(err, &serr) {
+					t.Errorf("%s: want SignatureError, got %v", u, err)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_WebSocketNonce(t *testing.T) {
+	s := &Server{}
+	s.Start()
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	dialer := &websocket.Dialer{
+		Subprotocols: []string{Subprotocol},
+	}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"it":1234567890.5,"nonce":"abc"}`)); err != nil {
+		t.Fatal(err)
+	}
+	var res Response
+	if err := conn.ReadJSON(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Nonce != "abc" {
+		t.Errorf("unexpected nonce: want %q, got %q", "abc", res.Nonce)
+	}
+	if want := time.Unix(1234567890, 5e8); !time.Time(res.InitiateTime).Equal(want) {
+		t.Errorf("unexpected it: want %s, got %s", want, time.Time(res.InitiateTime))
+	}
+	if res.Signature != "" {
+		t.Errorf("unexpected signature: %q", res.Signature)
+	}
+}
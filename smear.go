@@ -0,0 +1,98 @@
+package webntp
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// smearState keeps the clock readings to smear through the repeated second.
+type smearState struct {
+	mu     sync.Mutex
+	last   time.Time // the last reading of the Clock
+	repeat time.Time // the leap second whose last second the Clock is repeating
+	served time.Time // the last smeared time
+}
+
+// smearedNow returns the current time of the server, smeared around leap seconds.
+// It also reports whether the time is being smeared.
+//
+// The smear is linear over the LeapSmear window centered at the leap second.
+// The Clock is assumed to be a POSIX clock, which repeats (or skips) a second at the leap second.
+// So the smeared time runs slower (or faster) by Step seconds over the window,
+// and it equals the Clock outside the window.
+// The server detects the repeated second by the Clock stepping back,
+// and the smeared time never goes backwards.
+func (s *Server) smearedNow() (time.Time, bool) {
+	now := s.now()
+	if s.LeapSmear <= 0 {
+		return now, false
+	}
+	list, ok := s.leapSecondsList.Load().(*LeapSecondsList)
+	if !ok {
+		return now, false
+	}
+	var leap LeapSecond
+	for _, l := range list.LeapSeconds {
+		if _, ok := smear(now, l, s.LeapSmear, false); ok {
+			leap = l
+			break
+		}
+	}
+	if leap.Step == 0 {
+		return now, false
+	}
+
+	st := &s.smear
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	// read the Clock again in the lock, so that the readings are in order.
+	now = s.now()
+	begin := leap.At.Add(-time.Second)
+	inLeap := !now.Before(begin) && now.Before(leap.At)
+	if leap.Step > 0 && inLeap && !st.last.Before(begin) && st.last.Before(leap.At) && now.Before(st.last) {
+		// the Clock has been stepped back to repeat the last second, i.e. 23:59:60.
+		st.repeat = leap.At
+	}
+	st.last = now
+
+	smeared, ok := smear(now, leap, s.LeapSmear, inLeap && st.repeat.Equal(leap.At))
+	if !ok {
+		return smeared, false
+	}
+	if smeared.Before(st.served) && st.served.Sub(smeared) <= time.Second {
+		// e.g. the repeated second was not detected, because there was no request in the first one.
+		smeared = st.served
+	}
+	st.served = smeared
+	return smeared, true
+}
+
+// smear smears now around leap over window.
+// repeating reports whether now is in the repeated second of the inserted leap second.
+// It reports whether now is in the window.
+func smear(now time.Time, leap LeapSecond, window time.Duration, repeating bool) (time.Time, bool) {
+	if leap.Step == 0 {
+		return now, false
+	}
+	start := leap.At.Add(-window / 2)
+	end := start.Add(window)
+	if now.Before(start) || !now.Before(end) {
+		return now, false
+	}
+
+	// the real time since start, which the Clock lacks (or exceeds) by step after the leap second.
+	step := time.Duration(leap.Step) * time.Second
+	elapsed := now.Sub(start)
+	if repeating || !now.Before(leap.At) {
+		elapsed += step
+	}
+	// the smeared time runs the window in the real time of window + step.
+	return start.Add(fraction(window, elapsed, window+step)), true
+}
+
+// fraction returns d * n / m, rounded to the nearest nanosecond.
+func fraction(d, n, m time.Duration) time.Duration {
+	return time.Duration(math.Round(float64(d) * float64(n) / float64(m)))
+}
@@ -0,0 +1,206 @@
+package webntp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSmear(t *testing.T) {
+	at, _ := time.Parse(time.RFC3339, "2017-01-01T00:00:00Z")
+	parse := func(s string) time.Time {
+		t.Helper()
+		tt, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tt
+	}
+
+	testCases := []struct {
+		now       string
+		step      int
+		repeating bool
+		want      string
+		smearing  bool
+	}{
+		// insertion
+		{"2016-12-31T11:59:59Z", 1, false, "2016-12-31T11:59:59Z", false},
+		{"2016-12-31T12:00:00Z", 1, false, "2016-12-31T12:00:00Z", true},
+		{"2016-12-31T18:00:00Z", 1, false, "2016-12-31T17:59:59.750002893Z", true},
+		{"2016-12-31T23:59:59Z", 1, false, "2016-12-31T23:59:58.500017361Z", true},
+		{"2016-12-31T23:59:59Z", 1, true, "2016-12-31T23:59:59.500005787Z", true}, // 23:59:60
+		{"2017-01-01T00:00:00Z", 1, false, "2017-01-01T00:00:00.499994213Z", true},
+		{"2017-01-01T06:00:00Z", 1, false, "2017-01-01T06:00:00.249997107Z", true},
+		{"2017-01-01T12:00:00Z", 1, false, "2017-01-01T12:00:00Z", false},
+
+		// deletion
+		{"2016-12-31T18:00:00Z", -1, false, "2016-12-31T18:00:00.250002894Z", true},
+		{"2016-12-31T23:59:58Z", -1, false, "2016-12-31T23:59:58.499982639Z", true},
+		{"2017-01-01T00:00:00Z", -1, false, "2016-12-31T23:59:59.499994213Z", true},
+		{"2017-01-01T06:00:00Z", -1, false, "2017-01-01T05:59:59.749997106Z", true},
+	}
+	for _, tc := range testCases {
+		leap := LeapSecond{At: at, Leap: 36, Step: tc.step}
+		got, smearing := smear(parse(tc.now), leap, 24*time.Hour, tc.repeating)
+		if want := parse(tc.want); !got.Equal(want) {
+			t.Errorf("%s (step %d): want %s, got %s", tc.now, tc.step, want.Format(time.RFC3339Nano), got.Format(time.RFC3339Nano))
+		}
+		if smearing != tc.smearing {
+			t.Errorf("%s (step %d): want smearing %t, got %t", tc.now, tc.step, tc.smearing, smearing)
+		}
+	}
+}
+
+func TestServer_LeapSmear(t *testing.T) {
+	var now time.Time
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return now
+		}),
+		LeapSecondsPath: "testdata/leap-seconds-2019-05-02.list",
+		LeapSmear:       24 * time.Hour,
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	next, _ := time.Parse(time.RFC3339, "2017-01-01T00:00:00Z")
+
+	now, _ = time.Parse(time.RFC3339, "2016-12-31T18:00:00Z")
+	// 17:59:59.750002893, in microseconds of Timestamp.
+	smeared, _ := time.Parse(time.RFC3339Nano, "2016-12-31T17:59:59.750003Z")
+
+	// JSON over HTTP
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rw := httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	var res Response
+	if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if !res.Smear {
+		t.Error("want smear, got not")
+	}
+	if !time.Time(res.SendTime).Equal(smeared) {
+		t.Errorf("unexpected st: want %s, got %s", smeared, time.Time(res.SendTime))
+	}
+	if !time.Time(res.Next).Equal(next) || res.Leap != 36 || res.Step != 1 {
+		t.Errorf("unexpected leap second: next %s, leap %d, step %d", time.Time(res.Next), res.Leap, res.Step)
+	}
+
+	// Time over HTTPS
+	req = httptest.NewRequest(http.MethodHead, WellKnownTimePath, nil)
+	rw = httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	if got, want := rw.Header().Get("X-HTTPSTIME"), "1483207199.750003"; got != want {
+		t.Errorf("unexpected X-HTTPSTIME: want %s, got %s", want, got)
+	}
+
+	// out of the window
+	now, _ = time.Parse(time.RFC3339, "2016-12-31T06:00:00Z")
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	rw = httptest.NewRecorder()
+	s.ServeHTTP(rw, req)
+	res = Response{}
+	if err := json.Unmarshal(rw.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Smear {
+		t.Error("want no smear, got smear")
+	}
+	if !time.Time(res.SendTime).Equal(now) {
+		t.Errorf("unexpected st: want %s, got %s", now, time.Time(res.SendTime))
+	}
+}
+
+func TestServer_LeapSmear_RepeatedSecond(t *testing.T) {
+	var mu sync.Mutex
+	var now time.Time
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return now
+		}),
+		LeapSecondsPath: "testdata/leap-seconds-2019-05-02.list",
+		LeapSmear:       24 * time.Hour,
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// the POSIX clock repeats 23:59:59 for 23:59:60.
+	clock := []string{
+		"2016-12-31T23:59:58.5Z",
+		"2016-12-31T23:59:59Z",
+		"2016-12-31T23:59:59.5Z",
+		"2016-12-31T23:59:59.9Z",
+		"2016-12-31T23:59:59Z", // 23:59:60
+		"2016-12-31T23:59:59.5Z",
+		"2016-12-31T23:59:59.9Z",
+		"2017-01-01T00:00:00Z",
+		"2017-01-01T00:00:00.5Z",
+	}
+	var last time.Time
+	for i, c := range clock {
+		mu.Lock()
+		now, _ = time.Parse(time.RFC3339Nano, c)
+		mu.Unlock()
+		got, smearing := s.smearedNow()
+		if !smearing {
+			t.Errorf("%d: want smearing", i)
+		}
+		if i > 0 {
+			// the smeared time advances a little slower than the real time.
+			if d := got.Sub(last); d <= 0 || d > time.Second {
+				t.Errorf("%d: %s: unexpected step %s from %s to %s", i, c, d, last.Format(time.RFC3339Nano), got.Format(time.RFC3339Nano))
+			}
+		}
+		last = got
+	}
+}
+
+func TestServer_LeapSmear_WebSocket(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2016-12-31T18:00:00Z")
+	s := &Server{
+		Clock: ClockFunc(func() time.Time {
+			return now
+		}),
+		LeapSecondsPath: "testdata/leap-seconds-2019-05-02.list",
+		LeapSmear:       24 * time.Hour,
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	// the DefaultDialer offers the NTP subprotocol first, but NTP packets are not smeared.
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	conn, _, err := DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if got := conn.Subprotocol(); got != Subprotocol {
+		t.Errorf("unexpected subprotocol: want %s, got %s", Subprotocol, got)
+	}
+
+	c := &Client{}
+	result, err := c.Get(context.Background(), u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Smear {
+		t.Error("want smear, got not")
+	}
+}
@@ -0,0 +1,118 @@
+package webntp
+
+import (
+	"sort"
+	"time"
+)
+
+// taiMinusGPS is TAI - GPS time, fixed since the GPS epoch, 6 January 1980.
+const taiMinusGPS = 19 * time.Second
+
+// The conversions between time scales represent TAI and GPS time as time.Time
+// whose date and clock read the time in the scale, e.g. 2017-01-01T00:00:37Z for TAI
+// at 2017-01-01T00:00:00Z UTC. time.Time has no leap seconds,
+// so UTC is represented as Unix time, which repeats 23:59:59 for inserted leap seconds.
+// Before 1 January 1972, TAI - UTC is assumed to be the initial 10 seconds,
+// though it was not an integer then.
+
+// leapSecond returns the first leap second after t, or the last one if there is no leap second after t.
+// l must have at least one leap second.
+func (l *LeapSecondsList) leapSecond(t time.Time) LeapSecond {
+	i := sort.Search(len(l.LeapSeconds), func(i int) bool {
+		return t.Before(l.LeapSeconds[i].At)
+	})
+	if i == len(l.LeapSeconds) {
+		return l.LeapSeconds[i-1]
+	}
+	return l.LeapSeconds[i]
+}
+
+// TAIMinusUTC returns TAI - UTC in seconds at t in UTC.
+// It returns 0 if l has no leap seconds.
+func (l *LeapSecondsList) TAIMinusUTC(t time.Time) int {
+	if len(l.LeapSeconds) == 0 {
+		return 0
+	}
+	leap := l.leapSecond(t)
+	if t.Before(leap.At) {
+		return leap.Leap
+	}
+	return leap.Leap + leap.Step
+}
+
+// UTCToTAI converts t in UTC to TAI.
+func (l *LeapSecondsList) UTCToTAI(t time.Time) time.Time {
+	return t.Add(time.Duration(l.TAIMinusUTC(t)) * time.Second)
+}
+
+// TAIToUTC converts t in TAI to UTC.
+// The inserted leap second 23:59:60 is converted to 23:59:59 as Unix time does.
+func (l *LeapSecondsList) TAIToUTC(t time.Time) time.Time {
+	if len(l.LeapSeconds) == 0 {
+		return t
+	}
+	// the first leap second that ends after t in TAI.
+	i := sort.Search(len(l.LeapSeconds), func(i int) bool {
+		leap := l.LeapSeconds[i]
+		return t.Before(leap.At.Add(time.Duration(leap.Leap+leap.Step) * time.Second))
+	})
+	if i == len(l.LeapSeconds) {
+		last := l.LeapSeconds[i-1]
+		return t.Add(-time.Duration(last.Leap+last.Step) * time.Second)
+	}
+	leap := l.LeapSeconds[i]
+	utc := t.Add(-time.Duration(leap.Leap) * time.Second)
+	if !utc.Before(leap.At) {
+		// in the inserted leap second.
+		utc = utc.Add(-time.Second)
+	}
+	return utc
+}
+
+// UTCToGPS converts t in UTC to GPS time.
+func (l *LeapSecondsList) UTCToGPS(t time.Time) time.Time {
+	return l.UTCToTAI(t).Add(-taiMinusGPS)
+}
+
+// GPSToUTC converts t in GPS time to UTC.
+func (l *LeapSecondsList) GPSToUTC(t time.Time) time.Time {
+	return l.TAIToUTC(t.Add(taiMinusGPS))
+}
+
+// InLeapSecond reports whether t in UTC is in the last second of a day with a leap second,
+// i.e. in [At - 1s, At) of a leap second.
+// The second is repeated as 23:59:59 and 23:59:60 for an inserted leap second,
+// and it doesn't exist in UTC for a deleted one.
+func (l *LeapSecondsList) InLeapSecond(t time.Time) bool {
+	if len(l.LeapSeconds) == 0 {
+		return false
+	}
+	leap := l.leapSecond(t)
+	return t.Before(leap.At) && !t.Before(leap.At.Add(-time.Second))
+}
+
+// ValidAt reports whether l covers all the leap seconds until t, i.e. t is not after the expiration date.
+// It is false if l has no expiration date.
+func (l *LeapSecondsList) ValidAt(t time.Time) bool {
+	return !l.ExpireAt.IsZero() && !t.After(l.ExpireAt)
+}
+
+// LeapSecondsList returns the leap second in r as a LeapSecondsList,
+// so that the client can convert time scales with it.
+// The list has only the next or last leap second that the server reported, and no dates,
+// so it is accurate only between the previous and the next leap seconds of NextLeap.
+// It returns nil if r has no leap second, e.g. SNTP responses without the leap second extension.
+func (r Result) LeapSecondsList() *LeapSecondsList {
+	if r.Step == 0 {
+		return nil
+	}
+	return &LeapSecondsList{
+		LeapSeconds: []LeapSecond{
+			{
+				At:   r.NextLeap,
+				Leap: int(r.TAIOffset / time.Second),
+				Step: r.Step,
+			},
+		},
+	}
+}
@@ -0,0 +1,172 @@
+package webntp
+
+import (
+	"testing"
+	"time"
+)
+
+func timescaleTestList(t *testing.T) *LeapSecondsList {
+	t.Helper()
+	list := DefaultLeapSecondsList()
+	// a negative leap second in the future.
+	list.LeapSeconds = append(list.LeapSeconds, LeapSecond{
+		At:   time.Date(2030, time.July, 1, 0, 0, 0, 0, time.UTC),
+		Leap: 37,
+		Step: -1,
+	})
+	list.ExpireAt = time.Date(2031, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return list
+}
+
+func TestLeapSecondsList_TAIMinusUTC(t *testing.T) {
+	list := timescaleTestList(t)
+	tests := []struct {
+		utc  string
+		want int
+	}{
+		{"1970-01-01T00:00:00Z", 10},
+		{"1972-06-30T23:59:59Z", 10},
+		{"1972-07-01T00:00:00Z", 11},
+		{"2016-12-31T23:59:59.5Z", 36},
+		{"2017-01-01T00:00:00Z", 37},
+		{"2030-06-30T23:59:58Z", 37},
+		{"2030-07-01T00:00:00Z", 36},
+		{"2040-01-01T00:00:00Z", 36},
+	}
+	for _, tc := range tests {
+		utc, err := time.Parse(time.RFC3339Nano, tc.utc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := list.TAIMinusUTC(utc); got != tc.want {
+			t.Errorf("%s: want %d, got %d", tc.utc, tc.want, got)
+		}
+	}
+
+	if got := (&LeapSecondsList{}).TAIMinusUTC(time.Now()); got != 0 {
+		t.Errorf("empty list: want 0, got %d", got)
+	}
+}
+
+func TestLeapSecondsList_TAIToUTC(t *testing.T) {
+	list := timescaleTestList(t)
+	tests := []struct {
+		utc string
+		tai string
+	}{
+		{"1972-01-01T00:00:00Z", "1972-01-01T00:00:10Z"},
+		{"2016-12-31T23:59:58Z", "2017-01-01T00:00:34Z"},
+		{"2016-12-31T23:59:59Z", "2017-01-01T00:00:35Z"},
+		{"2016-12-31T23:59:59Z", "2017-01-01T00:00:36Z"}, // 23:59:60
+		{"2016-12-31T23:59:59.5Z", "2017-01-01T00:00:36.5Z"},
+		{"2017-01-01T00:00:00Z", "2017-01-01T00:00:37Z"},
+		{"2030-06-30T23:59:58Z", "2030-07-01T00:00:35Z"},
+		{"2030-06-30T23:59:58.5Z", "2030-07-01T00:00:35.5Z"},
+		{"2030-07-01T00:00:00Z", "2030-07-01T00:00:36Z"},
+		{"2040-01-01T00:00:00Z", "2040-01-01T00:00:36Z"},
+	}
+	for _, tc := range tests {
+		utc, err := time.Parse(time.RFC3339Nano, tc.utc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tai, err := time.Parse(time.RFC3339Nano, tc.tai)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := list.TAIToUTC(tai); !got.Equal(utc) {
+			t.Errorf("TAIToUTC(%s): want %s, got %s", tc.tai, tc.utc, got.Format(time.RFC3339Nano))
+		}
+	}
+}
+
+func TestLeapSecondsList_RoundTrip(t *testing.T) {
+	list := timescaleTestList(t)
+	for utc := leapSecondsEpoch; utc.Year() < 2040; utc = utc.Add(7*time.Hour + 123*time.Millisecond) {
+		if got := list.TAIToUTC(list.UTCToTAI(utc)); !got.Equal(utc) {
+			t.Fatalf("TAI round trip of %s: got %s", utc, got)
+		}
+		if got := list.GPSToUTC(list.UTCToGPS(utc)); !got.Equal(utc) {
+			t.Fatalf("GPS round trip of %s: got %s", utc, got)
+		}
+	}
+}
+
+func TestLeapSecondsList_UTCToGPS(t *testing.T) {
+	list := timescaleTestList(t)
+	tests := []struct {
+		utc, gps string
+	}{
+		{"1980-01-06T00:00:00Z", "1980-01-06T00:00:00Z"},
+		{"2017-01-01T00:00:00Z", "2017-01-01T00:00:18Z"},
+	}
+	for _, tc := range tests {
+		utc, err := time.Parse(time.RFC3339, tc.utc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := list.UTCToGPS(utc).Format(time.RFC3339); got != tc.gps {
+			t.Errorf("UTCToGPS(%s): want %s, got %s", tc.utc, tc.gps, got)
+		}
+	}
+}
+
+func TestLeapSecondsList_InLeapSecond(t *testing.T) {
+	list := timescaleTestList(t)
+	tests := []struct {
+		utc  string
+		want bool
+	}{
+		{"2016-12-31T23:59:58.999Z", false},
+		{"2016-12-31T23:59:59Z", true},
+		{"2016-12-31T23:59:59.999Z", true},
+		{"2017-01-01T00:00:00Z", false},
+		{"2030-06-30T23:59:59.5Z", true},
+		{"2040-01-01T00:00:00Z", false},
+	}
+	for _, tc := range tests {
+		utc, err := time.Parse(time.RFC3339Nano, tc.utc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := list.InLeapSecond(utc); got != tc.want {
+			t.Errorf("%s: want %t, got %t", tc.utc, tc.want, got)
+		}
+	}
+}
+
+func TestLeapSecondsList_ValidAt(t *testing.T) {
+	list := timescaleTestList(t)
+	if !list.ValidAt(list.ExpireAt) {
+		t.Error("want valid at the expiration date")
+	}
+	if list.ValidAt(list.ExpireAt.Add(time.Second)) {
+		t.Error("want invalid after the expiration date")
+	}
+	if (&LeapSecondsList{}).ValidAt(leapSecondsEpoch) {
+		t.Error("want invalid without the expiration date")
+	}
+}
+
+func TestResult_LeapSecondsList(t *testing.T) {
+	next := time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC)
+	result := Result{
+		NextLeap:  next,
+		TAIOffset: 36 * time.Second,
+		Step:      1,
+	}
+	list := result.LeapSecondsList()
+	if got := list.TAIMinusUTC(next.Add(-time.Hour)); got != 36 {
+		t.Errorf("want 36, got %d", got)
+	}
+	if got := list.TAIMinusUTC(next); got != 37 {
+		t.Errorf("want 37, got %d", got)
+	}
+	if !list.InLeapSecond(next.Add(-time.Second / 2)) {
+		t.Error("want in the leap second")
+	}
+
+	if list := (Result{}).LeapSecondsList(); list != nil {
+		t.Errorf("want nil, got %v", list)
+	}
+}
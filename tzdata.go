@@ -0,0 +1,296 @@
+package webntp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the initial TAI - UTC on 1 January 1972.
+const initialTAIUTC = 10
+
+// ParseTZDataLeapSeconds parses the leapseconds file of the tz database,
+// e.g. /usr/share/zoneinfo/leapseconds.
+// The expiration date is taken from the "#expires" or "Expires" line, and it is required.
+// The update date is taken from the "#updated" line if any.
+// It returns *LeapSecondsParseError if the file is malformed.
+func ParseTZDataLeapSeconds(r io.Reader) (*LeapSecondsList, error) {
+	data, err := readLeapSeconds(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &tzdataParser{leap: initialTAIUTC}
+	for len(data) > 0 {
+		var line []byte
+		line, data, _ = bytes.Cut(data, []byte{'\n'})
+		p.line++
+		if err := p.parseLine(string(line)); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.list) == 0 {
+		return nil, &LeapSecondsParseError{Err: ErrLeapSecondsListEmpty}
+	}
+	if p.expireAt.IsZero() {
+		return nil, &LeapSecondsParseError{Err: ErrLeapSecondsListNoExpire}
+	}
+	return &LeapSecondsList{
+		LeapSeconds: p.list,
+		UpdateAt:    p.updateAt,
+		ExpireAt:    p.expireAt,
+	}, nil
+}
+
+type tzdataParser struct {
+	line     int
+	leap     int // the current TAI - UTC
+	list     []LeapSecond
+	updateAt time.Time
+	expireAt time.Time
+}
+
+func (p *tzdataParser) errorf(err error, format string, args ...any) error {
+	return &LeapSecondsParseError{
+		Line:   p.line,
+		Err:    err,
+		Detail: fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *tzdataParser) parseLine(line string) error {
+	line = strings.TrimRight(line, "\r")
+	if comment, ok := strings.CutPrefix(line, "#"); ok {
+		f := strings.Fields(comment)
+		if len(f) < 2 {
+			return nil
+		}
+		switch f[0] {
+		case "updated":
+			// e.g. "#updated 1751846400 (2025-07-07 00:00:00 UTC)"
+			t, err := p.parseUnix(f[1])
+			if err != nil {
+				return err
+			}
+			p.updateAt = t
+		case "expires":
+			// e.g. "#expires 1782604800 (2026-06-28 00:00:00 UTC)"
+			t, err := p.parseUnix(f[1])
+			if err != nil {
+				return err
+			}
+			p.expireAt = t
+		case "Expires":
+			// older files have the expiration date commented out.
+			if p.expireAt.IsZero() {
+				return p.parseExpires(f)
+			}
+		}
+		return nil
+	}
+
+	fields, _, _ := strings.Cut(line, "#")
+	f := strings.Fields(fields)
+	if len(f) == 0 {
+		return nil
+	}
+	switch f[0] {
+	case "Leap":
+		return p.parseLeap(f)
+	case "Expires":
+		return p.parseExpires(f)
+	}
+	return p.errorf(ErrLeapSecondsListSyntax, "unexpected line %q", truncate(line, 32))
+}
+
+// parseLeap parses a leap second line, e.g. "Leap 2016 Dec 31 23:59:60 + S".
+func (p *tzdataParser) parseLeap(f []string) error {
+	if len(f) != 7 {
+		return p.errorf(ErrLeapSecondsListSyntax, "invalid Leap line")
+	}
+	date, err := p.parseDate(f[1:4])
+	if err != nil {
+		return err
+	}
+	var step int
+	switch {
+	case f[5] == "+" && f[4] == "23:59:60":
+		step = 1
+	case f[5] == "-" && f[4] == "23:59:59":
+		step = -1
+	default:
+		return p.errorf(ErrLeapSecondsListSyntax, "invalid leap second %s %s", truncate(f[4], 16), truncate(f[5], 16))
+	}
+	if f[6] != "S" {
+		// rolling leap seconds are in local time, which is not supported.
+		return p.errorf(ErrLeapSecondsListSyntax, "unsupported R/S %q", truncate(f[6], 16))
+	}
+
+	// the leap second ends at midnight of the next day.
+	at := date.AddDate(0, 0, 1)
+	if n := len(p.list); n > 0 && !p.list[n-1].At.Before(at) {
+		return p.errorf(ErrLeapSecondsListNotSorted, "%s follows %s", at.Format(time.DateOnly), p.list[n-1].At.Format(time.DateOnly))
+	}
+	p.list = append(p.list, LeapSecond{
+		At:   at,
+		Leap: p.leap,
+		Step: step,
+	})
+	p.leap += step
+	return nil
+}
+
+// parseExpires parses an expiration line, e.g. "Expires 2026 Jun 28 00:00:00".
+func (p *tzdataParser) parseExpires(f []string) error {
+	if len(f) != 5 {
+		return p.errorf(ErrLeapSecondsListSyntax, "invalid Expires line")
+	}
+	date, err := p.parseDate(f[1:4])
+	if err != nil {
+		return err
+	}
+	clock, err := time.Parse(time.TimeOnly, f[4])
+	if err != nil {
+		return p.errorf(ErrLeapSecondsListSyntax, "invalid time %q", truncate(f[4], 16))
+	}
+	h, m, s := clock.Clock()
+	p.expireAt = date.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second)
+	return nil
+}
+
+// parseDate parses the year, the month and the day, e.g. "2016 Dec 31".
+func (p *tzdataParser) parseDate(f []string) (time.Time, error) {
+	t, err := time.Parse("2006 Jan 2", strings.Join(f, " "))
+	if err != nil {
+		return time.Time{}, p.errorf(ErrLeapSecondsListSyntax, "invalid date %q", truncate(strings.Join(f, " "), 32))
+	}
+	return t, nil
+}
+
+// parseUnix parses seconds since the Unix epoch.
+func (p *tzdataParser) parseUnix(s string) (time.Time, error) {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 || v > 1<<40 {
+		return time.Time{}, p.errorf(ErrLeapSecondsListSyntax, "invalid Unix time %q", truncate(s, 32))
+	}
+	return time.Unix(v, 0).UTC(), nil
+}
+
+// ParseTZifLeapSeconds parses the leap second records of a TZif file
+// compiled with leap seconds, e.g. /usr/share/zoneinfo/right/UTC.
+// TZif files have no update date, and only version 4 files have the expiration date.
+// So UpdateAt is always zero, and ExpireAt may be zero.
+func ParseTZifLeapSeconds(r io.Reader) (*LeapSecondsList, error) {
+	data, err := readLeapSeconds(r)
+	if err != nil {
+		return nil, err
+	}
+
+	h, data, err := parseTZifHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	size := 4 // the size of time values
+	if h.version >= '2' {
+		// skip the version 1 data block, and use the 64-bit one.
+		if len(data) < h.v1DataSize() {
+			return nil, tzifError("truncated data")
+		}
+		h, data, err = parseTZifHeader(data[h.v1DataSize():])
+		if err != nil {
+			return nil, err
+		}
+		size = 8
+	}
+	offset := h.timecnt*size + h.timecnt + h.typecnt*6 + h.charcnt
+	if len(data) < offset+h.leapcnt*(size+4) {
+		return nil, tzifError("truncated data")
+	}
+	data = data[offset:]
+
+	var list []LeapSecond
+	var expireAt time.Time
+	leap := initialTAIUTC
+	correction := 0
+	for i := 0; i < h.leapcnt; i++ {
+		var occur int64
+		if size == 8 {
+			occur = int64(binary.BigEndian.Uint64(data))
+		} else {
+			occur = int64(int32(binary.BigEndian.Uint32(data)))
+		}
+		corr := int(int32(binary.BigEndian.Uint32(data[size:])))
+		data = data[size+4:]
+
+		// the occurrence counts the leap seconds so far.
+		at := time.Unix(occur-int64(correction), 0).UTC()
+		step := corr - correction
+		if step == 0 && i == h.leapcnt-1 {
+			// the last record with no correction change is the expiration date.
+			expireAt = at
+			break
+		}
+		if step != 1 && step != -1 {
+			return nil, &LeapSecondsParseError{Err: ErrLeapSecondsListInvalidStep, Detail: fmt.Sprintf("from %d to %d", correction, corr)}
+		}
+		if n := len(list); n > 0 && !list[n-1].At.Before(at) {
+			return nil, &LeapSecondsParseError{Err: ErrLeapSecondsListNotSorted, Detail: fmt.Sprintf("%s follows %s", at.Format(time.DateOnly), list[n-1].At.Format(time.DateOnly))}
+		}
+		list = append(list, LeapSecond{
+			At:   at,
+			Leap: leap,
+			Step: step,
+		})
+		leap += step
+		correction = corr
+	}
+	if len(list) == 0 {
+		return nil, &LeapSecondsParseError{Err: ErrLeapSecondsListEmpty}
+	}
+	return &LeapSecondsList{
+		LeapSeconds: list,
+		ExpireAt:    expireAt,
+	}, nil
+}
+
+type tzifHeader struct {
+	version                                               byte
+	isutcnt, isstdcnt, leapcnt, timecnt, typecnt, charcnt int
+}
+
+// v1DataSize returns the size of the version 1 data block.
+func (h tzifHeader) v1DataSize() int {
+	return h.timecnt*5 + h.typecnt*6 + h.charcnt + h.leapcnt*8 + h.isstdcnt + h.isutcnt
+}
+
+func parseTZifHeader(data []byte) (tzifHeader, []byte, error) {
+	if len(data) < 44 || string(data[:4]) != "TZif" {
+		return tzifHeader{}, nil, tzifError("invalid header")
+	}
+	var counts [6]int
+	for i := range counts {
+		v := binary.BigEndian.Uint32(data[20+i*4:])
+		if v > maxLeapSecondsListSize {
+			return tzifHeader{}, nil, tzifError("invalid header")
+		}
+		counts[i] = int(v)
+	}
+	h := tzifHeader{
+		version:  data[4],
+		isutcnt:  counts[0],
+		isstdcnt: counts[1],
+		leapcnt:  counts[2],
+		timecnt:  counts[3],
+		typecnt:  counts[4],
+		charcnt:  counts[5],
+	}
+	return h, data[44:], nil
+}
+
+func tzifError(detail string) error {
+	return &LeapSecondsParseError{Err: ErrLeapSecondsListSyntax, Detail: "TZif: " + detail}
+}
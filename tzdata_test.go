@@ -0,0 +1,169 @@
+package webntp
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// ietfLeapSeconds returns the leap seconds in testdata/leap-seconds-2019-05-02.list.
+func ietfLeapSeconds(t *testing.T) []LeapSecond {
+	t.Helper()
+	f, err := os.Open("testdata/leap-seconds-2019-05-02.list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	list, err := ParseLeapSecondsList(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list.LeapSeconds
+}
+
+func TestParseTZDataLeapSeconds(t *testing.T) {
+	f, err := os.Open("testdata/leapseconds-2025b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	list, err := ParseTZDataLeapSeconds(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no leap seconds since 2017.
+	if diff := cmp.Diff(ietfLeapSeconds(t), list.LeapSeconds); diff != "" {
+		t.Errorf("leap seconds mismatch (-want +got):\n%s", diff)
+	}
+	if want := time.Date(2025, time.July, 7, 0, 0, 0, 0, time.UTC); !list.UpdateAt.Equal(want) {
+		t.Errorf("unexpected UpdateAt: want %s, got %s", want, list.UpdateAt)
+	}
+	if want := time.Date(2026, time.June, 28, 0, 0, 0, 0, time.UTC); !list.ExpireAt.Equal(want) {
+		t.Errorf("unexpected ExpireAt: want %s, got %s", want, list.ExpireAt)
+	}
+}
+
+func TestParseTZDataLeapSeconds_Fixture(t *testing.T) {
+	input := "# a negative leap second\n" +
+		"Leap\t2016\tDec\t31\t23:59:60\t+\tS\n" +
+		"Leap\t2030\tJun\t30\t23:59:59\t-\tS\n" +
+		"Expires\t2031\tJan\t1\t12:00:00\n"
+	list, err := ParseTZDataLeapSeconds(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &LeapSecondsList{
+		LeapSeconds: []LeapSecond{
+			{At: time.Date(2017, time.January, 1, 0, 0, 0, 0, time.UTC), Leap: 10, Step: 1},
+			{At: time.Date(2030, time.July, 1, 0, 0, 0, 0, time.UTC), Leap: 11, Step: -1},
+		},
+		ExpireAt: time.Date(2031, time.January, 1, 12, 0, 0, 0, time.UTC),
+	}
+	if diff := cmp.Diff(want, list); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseTZDataLeapSeconds_Errors(t *testing.T) {
+	const expires = "#expires 1782604800 (2026-06-28 00:00:00 UTC)\n"
+	tests := map[string]struct {
+		input string
+		want  error
+	}{
+		"empty":       {expires, ErrLeapSecondsListEmpty},
+		"no expire":   {"Leap\t2016\tDec\t31\t23:59:60\t+\tS\n", ErrLeapSecondsListNoExpire},
+		"unknown":     {expires + "Zone\tEtc/UTC\t0\t-\tUTC\n", ErrLeapSecondsListSyntax},
+		"bad month":   {expires + "Leap\t2016\tFoo\t31\t23:59:60\t+\tS\n", ErrLeapSecondsListSyntax},
+		"bad time":    {expires + "Leap\t2016\tDec\t31\t23:59:59\t+\tS\n", ErrLeapSecondsListSyntax},
+		"rolling":     {expires + "Leap\t2016\tDec\t31\t23:59:60\t+\tR\n", ErrLeapSecondsListSyntax},
+		"bad expires": {"#expires soon\n", ErrLeapSecondsListSyntax},
+		"not sorted": {expires +
+			"Leap\t2016\tDec\t31\t23:59:60\t+\tS\n" +
+			"Leap\t2015\tJun\t30\t23:59:60\t+\tS\n", ErrLeapSecondsListNotSorted},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseTZDataLeapSeconds(strings.NewReader(tc.input))
+			var perr *LeapSecondsParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("want LeapSecondsParseError, got %v", err)
+			}
+			if !errors.Is(err, tc.want) {
+				t.Errorf("want %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func TestParseTZifLeapSeconds(t *testing.T) {
+	f, err := os.Open("testdata/right-UTC-2025b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	list, err := ParseTZifLeapSeconds(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(ietfLeapSeconds(t), list.LeapSeconds); diff != "" {
+		t.Errorf("leap seconds mismatch (-want +got):\n%s", diff)
+	}
+	if !list.UpdateAt.IsZero() || !list.ExpireAt.IsZero() {
+		t.Errorf("unexpected dates: %s, %s", list.UpdateAt, list.ExpireAt)
+	}
+}
+
+func TestParseTZifLeapSeconds_Errors(t *testing.T) {
+	data, err := os.ReadFile("testdata/right-UTC-2025b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"empty":     "",
+		"not TZif":  "Leap\t2016\tDec\t31\t23:59:60\t+\tS\n",
+		"header":    string(data[:44]),
+		"truncated": string(data[:len(data)-32]),
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseTZifLeapSeconds(strings.NewReader(input))
+			if !errors.Is(err, ErrLeapSecondsListSyntax) {
+				t.Errorf("want ErrLeapSecondsListSyntax, got %v", err)
+			}
+		})
+	}
+}
+
+func FuzzParseLeapSeconds(f *testing.F) {
+	for _, name := range []string{
+		"testdata/leapseconds-2025b",
+		"testdata/right-UTC-2025b",
+		"testdata/bulletinc-52.txt",
+	} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		list, err := ParseLeapSeconds(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		if len(list.LeapSeconds) == 0 {
+			t.Error("empty list")
+		}
+		for i := 1; i < len(list.LeapSeconds); i++ {
+			if !list.LeapSeconds[i-1].At.Before(list.LeapSeconds[i].At) {
+				t.Errorf("not sorted: %v", list.LeapSeconds)
+			}
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package webntp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// leapSecondsPollInterval is the interval of polling the cache file
+// where the file system notification is not available.
+// It is a variable for tests.
+var leapSecondsPollInterval = time.Minute
+
+// ErrLeapSecondsNotNewer is returned by ReloadLeapSeconds
+// if the file is not newer than the active list, e.g. the same list or an older cache.
+var ErrLeapSecondsNotNewer = errors.New("webntp: the leap seconds file is not newer than the active list")
+
+// ReloadLeapSeconds reads LeapSecondsPath again,
+// and replaces the active list if the file is newer, or if the server never fetches.
+// It returns an error if the file is missing or malformed, and the active list is kept.
+// It returns ErrLeapSecondsNotNewer if the active list is kept because the file is not newer.
+// The server also reloads the file automatically when the file changes.
+func (s *Server) ReloadLeapSeconds() error {
+	if s.LeapSecondsPath == "" {
+		return errors.New("webntp: LeapSecondsPath is empty")
+	}
+	f, err := os.Open(s.LeapSecondsPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	data, err := readLeapSeconds(f)
+	if err != nil {
+		return err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	list, err := s.parseLeapSecondsFile(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if otherLeapSecondsParser(data) != nil {
+		// LeapSecondsListHandler serves it in the format of leap-seconds.list.
+		data = nil
+	}
+	if !s.setLeapSecondsList(list, s.LeapSecondsPath, data, stat.ModTime()) {
+		return ErrLeapSecondsNotNewer
+	}
+	return nil
+}
+
+// startWatchingLeapSeconds starts reloading LeapSecondsPath on change until the server is closed.
+func (s *Server) startWatchingLeapSeconds() {
+	w, err := newFileWatcher(s.LeapSecondsPath)
+	if err != nil {
+		s.logger().Info("polling leap seconds", slog.String("path", s.LeapSecondsPath), slog.Any("err", err))
+		w = newPollWatcher(s.LeapSecondsPath, leapSecondsPollInterval)
+	}
+
+	reload := func() {
+		err := s.ReloadLeapSeconds()
+		if err != nil && !errors.Is(err, ErrLeapSecondsNotNewer) {
+			// the cache written by the server itself is not newer.
+			s.logger().Error("failed to reload leap seconds", slog.String("path", s.LeapSecondsPath), slog.Any("err", err))
+		}
+	}
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		if err := w.run(s.ctx, reload); err != nil {
+			s.logger().Error("failed to watch leap seconds", slog.String("path", s.LeapSecondsPath), slog.Any("err", err))
+		}
+	}()
+}
+
+// fileWatcher watches a file.
+type fileWatcher interface {
+	// run calls f when the file changes, until ctx is done.
+	run(ctx context.Context, f func()) error
+}
+
+// pollWatcher watches a file by polling its modification time and size.
+// Missing files are ignored.
+type pollWatcher struct {
+	path     string
+	interval time.Duration
+	modTime  time.Time
+	size     int64
+}
+
+func newPollWatcher(path string, interval time.Duration) *pollWatcher {
+	w := &pollWatcher{
+		path:     path,
+		interval: interval,
+	}
+	w.modTime, w.size = w.stat()
+	return w
+}
+
+func (w *pollWatcher) stat() (time.Time, int64) {
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		return time.Time{}, -1
+	}
+	return fi.ModTime(), fi.Size()
+}
+
+func (w *pollWatcher) run(ctx context.Context, f func()) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+		modTime, size := w.stat()
+		if modTime.Equal(w.modTime) && size == w.size {
+			continue
+		}
+		w.modTime, w.size = modTime, size
+		if size >= 0 {
+			f()
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package webntp
+
+import "errors"
+
+// newFileWatcher is not supported. The server polls the file instead.
+func newFileWatcher(path string) (fileWatcher, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,71 @@
+//go:build linux
+// +build linux
+
+package webntp
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// inotifyWatcher watches a file with inotify.
+// It watches the directory, because the file may be replaced by renaming.
+type inotifyWatcher struct {
+	file *os.File
+	name string
+}
+
+func newFileWatcher(path string) (fileWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	if _, err := syscall.InotifyAddWatch(fd, dir, syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+	return &inotifyWatcher{
+		file: os.NewFile(uintptr(fd), "inotify"),
+		name: name,
+	}, nil
+}
+
+func (w *inotifyWatcher) run(ctx context.Context, f func()) error {
+	defer w.file.Close()
+
+	// Close unblocks Read.
+	stop := context.AfterFunc(ctx, func() { w.file.Close() })
+	defer stop()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		changed := false
+		for events := buf[:n]; len(events) >= syscall.SizeofInotifyEvent; {
+			l := int(binary.NativeEndian.Uint32(events[12:16]))
+			end := min(syscall.SizeofInotifyEvent+l, len(events))
+			if string(bytes.TrimRight(events[syscall.SizeofInotifyEvent:end], "\x00")) == w.name {
+				changed = true
+			}
+			events = events[end:]
+		}
+		if changed {
+			f()
+		}
+	}
+}
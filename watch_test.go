@@ -0,0 +1,192 @@
+package webntp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitFor waits for cond to be true.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServer_ReloadLeapSeconds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leap-seconds.list")
+	data := reissueLeapSecondsList(t, time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2030, time.December, 28, 0, 0, 0, 0, time.UTC))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		LeapSecondsPath: path,
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := s.LeapSecondsSource(); got != path {
+		t.Errorf("unexpected source: want %s, got %s", path, got)
+	}
+
+	// newer
+	expireAt := time.Date(2031, time.June, 28, 0, 0, 0, 0, time.UTC)
+	if err := os.WriteFile(path, reissueLeapSecondsList(t, time.Date(2031, time.January, 1, 0, 0, 0, 0, time.UTC), expireAt), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReloadLeapSeconds(); err != nil {
+		t.Fatal(err)
+	}
+	list := s.leapSecondsList.Load().(*LeapSecondsList)
+	if !list.ExpireAt.Equal(expireAt) {
+		t.Errorf("unexpected ExpireAt: want %s, got %s", expireAt, list.ExpireAt)
+	}
+
+	// malformed
+	if err := os.WriteFile(path, []byte("<html></html>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReloadLeapSeconds(); err == nil {
+		t.Error("want error, got nil")
+	}
+	if s.leapSecondsList.Load().(*LeapSecondsList) != list {
+		t.Error("the list is replaced")
+	}
+
+	// missing
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReloadLeapSeconds(); !os.IsNotExist(err) {
+		t.Errorf("want not exist error, got %v", err)
+	}
+}
+
+func TestServer_ReloadLeapSeconds_NotNewer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leap-seconds.list")
+	updateAt := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	expireAt := time.Date(2030, time.December, 28, 0, 0, 0, 0, time.UTC)
+	if err := os.WriteFile(path, reissueLeapSecondsList(t, updateAt, expireAt), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		// the file is the cache of the fetched list.
+		// the list doesn't expire soon, so the server doesn't fetch it.
+		LeapSecondsPath: path,
+		LeapSecondsURL:  "http://127.0.0.1:0/leap-seconds.list",
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	list := s.leapSecondsList.Load().(*LeapSecondsList)
+
+	// the same file
+	if err := s.ReloadLeapSeconds(); !errors.Is(err, ErrLeapSecondsNotNewer) {
+		t.Errorf("want ErrLeapSecondsNotNewer, got %v", err)
+	}
+
+	// older
+	if err := os.WriteFile(path, reissueLeapSecondsList(t, updateAt.AddDate(-1, 0, 0), expireAt.AddDate(-1, 0, 0)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReloadLeapSeconds(); !errors.Is(err, ErrLeapSecondsNotNewer) {
+		t.Errorf("want ErrLeapSecondsNotNewer, got %v", err)
+	}
+	if s.leapSecondsList.Load().(*LeapSecondsList) != list {
+		t.Error("the list is replaced")
+	}
+	if got := s.LeapSecondsSource(); got != path {
+		t.Errorf("unexpected source: want %s, got %s", path, got)
+	}
+}
+
+func TestServer_WatchLeapSeconds(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "leap-seconds.list")
+	s := &Server{
+		LeapSecondsPath: path,
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := s.LeapSecondsSource(); got != LeapSecondsSourceEmbedded {
+		t.Errorf("unexpected source: want %s, got %s", LeapSecondsSourceEmbedded, got)
+	}
+
+	// replaced by renaming
+	expireAt := time.Date(2030, time.December, 28, 0, 0, 0, 0, time.UTC)
+	tmp := filepath.Join(dir, "tmp")
+	if err := os.WriteFile(tmp, reissueLeapSecondsList(t, time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC), expireAt), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		return s.leapSecondsList.Load().(*LeapSecondsList).ExpireAt.Equal(expireAt)
+	})
+	if got := s.LeapSecondsSource(); got != path {
+		t.Errorf("unexpected source: want %s, got %s", path, got)
+	}
+
+	// written in place
+	expireAt = time.Date(2031, time.June, 28, 0, 0, 0, 0, time.UTC)
+	if err := os.WriteFile(path, reissueLeapSecondsList(t, time.Date(2031, time.January, 1, 0, 0, 0, 0, time.UTC), expireAt), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		return s.leapSecondsList.Load().(*LeapSecondsList).ExpireAt.Equal(expireAt)
+	})
+}
+
+func TestPollWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leap-seconds.list")
+	w := newPollWatcher(path, 10*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan struct{}, 1)
+	done := make(chan error)
+	go func() {
+		done <- w.run(ctx, func() {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		})
+	}()
+
+	// created
+	if err := os.WriteFile(path, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ch:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	// modified
+	if err := os.WriteFile(path, []byte("ab"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ch:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
@@ -1,13 +1,16 @@
 package webntp
 
 import (
-	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 	"math"
-	"sort"
 	"strconv"
+	"strings"
 	"time"
-	"unicode"
 )
 
 // Timestamp is posix unix timestamp.
@@ -26,14 +29,21 @@ func init() {
 // MarshalJSON converts the timestamp to JSON number.
 // The number is unix timestamp.
 func (t Timestamp) MarshalJSON() ([]byte, error) {
-	// write seconds.
+	// round to microsecond.
 	tt := time.Time(t)
+	sec := tt.Unix()
+	m := (time.Duration(tt.Nanosecond()) + 500*time.Nanosecond) / time.Microsecond
+	if m >= 1000000 {
+		sec++
+		m -= 1000000
+	}
+
+	// write seconds.
 	b := make([]byte, 0, 20)
-	b = strconv.AppendInt(b, tt.Unix(), 10)
+	b = strconv.AppendInt(b, sec, 10)
 	b = append(b, '.')
 
 	// write microsecond
-	m := (time.Duration(tt.Nanosecond()) + 500*time.Nanosecond) / time.Microsecond
 	switch {
 	case m < 10:
 		b = append(b, '0', '0', '0', '0', '0')
@@ -126,6 +136,21 @@ type Response struct {
 	// Step describes next or last leap second is insertion or deletion.
 	// +1 is insertion, -1 is deletion.
 	Step int `json:"step"`
+
+	// Smear reports whether the leap smear is in effect.
+	// If true, SendTime is smeared and Leap, Next and Step describe the real leap second.
+	Smear bool `json:"smear,omitempty"`
+
+	// Stale reports whether the leap seconds list of the server is expired or missing.
+	// If true, Leap, Next and Step may miss the leap seconds announced after the expiration.
+	Stale bool `json:"stale,omitempty"`
+
+	// Nonce is the nonce given by the client.
+	Nonce string `json:"nonce,omitempty"`
+
+	// Signature is the Ed25519 signature over id, it, st, leap, next, step, smear, stale and nonce, encoded in base64.
+	// It is set if the server has Server.SigningKey.
+	Signature string `json:"sig,omitempty"`
 }
 
 // LeapSecond is information for leap-seconds
@@ -133,7 +158,7 @@ type LeapSecond struct {
 	// At is the time to insert/delete a leap second.
 	At time.Time
 
-	// Leap is offset from TAI to UTC. (**after** LeapSecond.Time)
+	// Leap is offset from TAI to UTC. (**before** LeapSecond.At)
 	Leap int
 
 	// Step describes next leap second is insertion or deletion.
@@ -148,169 +173,288 @@ type LeapSecondsList struct {
 	ExpireAt    time.Time
 }
 
+// maxLeapSecondsListSize is the maximum size of leap-seconds.list.
+// The official list is about 10KB.
+const maxLeapSecondsListSize = 1 << 20
+
+// the reasons of LeapSecondsParseError.
+var (
+	ErrLeapSecondsListTooLarge    = errors.New("the list is too large")
+	ErrLeapSecondsListSyntax      = errors.New("syntax error")
+	ErrLeapSecondsListEmpty       = errors.New("no leap seconds")
+	ErrLeapSecondsListNotSorted   = errors.New("the dates are not in increasing order")
+	ErrLeapSecondsListInvalidStep = errors.New("TAI - UTC must change by one second")
+	ErrLeapSecondsListNoUpdate    = errors.New("missing the last update date (#$)")
+	ErrLeapSecondsListNoExpire    = errors.New("missing the expiration date (#@)")
+)
+
+// LeapSecondsParseError is the error returned when leap-seconds.list is malformed.
+type LeapSecondsParseError struct {
+	// Line is the line number where the error occurred, starting at 1.
+	// It is zero if the error is not related to a specific line.
+	Line int
+
+	// Err is the reason of the error, one of ErrLeapSecondsList*.
+	Err error
+
+	// Detail is the additional information.
+	Detail string
+}
+
+func (e *LeapSecondsParseError) Error() string {
+	msg := e.Err.Error()
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("webntp: leap-seconds.list:%d: %s", e.Line, msg)
+	}
+	return "webntp: leap-seconds.list: " + msg
+}
+
+func (e *LeapSecondsParseError) Unwrap() error {
+	return e.Err
+}
+
+// LeapSecondsHashError is the error returned when the hash of leap-seconds.list doesn't match.
+type LeapSecondsHashError struct {
+	// Want is the hash in the "#h" line. It is nil if the line is missing.
+	Want []byte
+
+	// Got is the SHA-1 hash of the data.
+	Got []byte
+}
+
+func (e *LeapSecondsHashError) Error() string {
+	if e.Want == nil {
+		return "webntp: leap-seconds.list has no hash"
+	}
+	return fmt.Sprintf("webntp: leap-seconds.list hash mismatch: want %x, got %x", e.Want, e.Got)
+}
+
 type leapSecondsParser struct {
-	r        *bufio.Reader
+	line     int
 	list     []LeapSecond
 	updateAt time.Time
 	expireAt time.Time
-	err      error
+
+	// for verifying the hash
+	update []byte // the digits of the last update date
+	expire []byte // the digits of the expiration date
+	data   []byte // the digits of the leap second lines
+	hash   []byte // the hash in the "#h" line
+
+	lastLine int // the line number of the last leap second
 }
 
 const ntpEpochOffset = (70*365 + 17) * 86400
 
 // ParseLeapSecondsList parses leap-second.list.
+// It returns *LeapSecondsParseError if the list is malformed.
+// It verifies the SHA-1 hash in the "#h" line, and returns *LeapSecondsHashError if it doesn't match.
 func ParseLeapSecondsList(r io.Reader) (*LeapSecondsList, error) {
-	p := &leapSecondsParser{
-		r: bufio.NewReaderSize(r, 1024),
+	return parseLeapSecondsList(r, false)
+}
+
+// ParseLeapSecondsListLax is like ParseLeapSecondsList, but it doesn't verify the hash.
+func ParseLeapSecondsListLax(r io.Reader) (*LeapSecondsList, error) {
+	return parseLeapSecondsList(r, true)
+}
+
+func parseLeapSecondsList(r io.Reader, lax bool) (*LeapSecondsList, error) {
+	data, err := readLeapSeconds(r)
+	if err != nil {
+		return nil, err
 	}
-	var err error
 
-LOOP:
-	for {
-		var r rune
-		r, _, err = p.r.ReadRune()
-		if err != nil {
-			break
-		}
-		switch {
-		case unicode.IsSpace(r):
-			continue
-		case r == '#':
-			// comment line
-			p.parseComment()
-		case '0' <= r && r <= '9':
-			// leap second line
-			err := p.r.UnreadRune()
-			if err != nil {
-				p.err = err
-				break LOOP
-			}
-			p.parseLeapSecond()
-		default:
-			// unknown line
-			p.skipLine()
+	p := &leapSecondsParser{}
+	for len(data) > 0 {
+		var line []byte
+		line, data, _ = bytes.Cut(data, []byte{'\n'})
+		p.line++
+		if err := p.parseLine(string(line)); err != nil {
+			return nil, err
 		}
-		if p.err != nil {
-			return nil, p.err
+	}
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	if !lax {
+		if err := p.verify(); err != nil {
+			return nil, err
 		}
 	}
 
-	sort.Slice(p.list, func(i, j int) bool {
-		return p.list[i].At.Before(p.list[j].At)
-	})
-	lastLeap := p.list[0].Leap
+	// the first line is not a leap second,
+	// it is the definition of the relationship between UTC and TAI.
+	list := make([]LeapSecond, 0, len(p.list)-1)
 	for i := 1; i < len(p.list); i++ {
-		p.list[i].Step = p.list[i].Leap - lastLeap
-		lastLeap, p.list[i].Leap = p.list[i].Leap, lastLeap
+		list = append(list, LeapSecond{
+			At:   p.list[i].At,
+			Leap: p.list[i-1].Leap,
+			Step: p.list[i].Leap - p.list[i-1].Leap,
+		})
 	}
-
 	return &LeapSecondsList{
-		LeapSeconds: p.list[1:],
+		LeapSeconds: list,
 		UpdateAt:    p.updateAt,
 		ExpireAt:    p.expireAt,
 	}, nil
 }
 
-func (p *leapSecondsParser) parseComment() {
-	var r rune
-	r, _, p.err = p.r.ReadRune()
-	if p.err != nil {
-		return
+// readLeapSeconds reads whole r up to maxLeapSecondsListSize.
+func readLeapSeconds(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxLeapSecondsListSize+1))
+	if err != nil {
+		return nil, err
 	}
-	switch r {
-	case '\n':
-		return
-	case ' ':
-		// normal comment line
-	case '$':
-		// last update date
-		i := p.getInt(64)
-		p.updateAt = time.Unix(i-ntpEpochOffset, 0)
-	case '@':
-		// the expiration date
-		i := p.getInt(64)
-		p.expireAt = time.Unix(i-ntpEpochOffset, 0)
-	case 'h':
-		// hash value of the data
-	default:
-		// unknown comment line. ignore it.
+	if len(data) > maxLeapSecondsListSize {
+		return nil, &LeapSecondsParseError{Err: ErrLeapSecondsListTooLarge}
 	}
-	p.skipLine()
+	return data, nil
 }
 
-func (p *leapSecondsParser) parseLeapSecond() {
-	at := p.getInt(64)
-	p.skipSpace()
-	leap := p.getInt(0)
-	p.skipSpace()
-	p.skipLine()
-	if p.err != nil {
-		return
+func (p *leapSecondsParser) errorf(err error, format string, args ...any) error {
+	return &LeapSecondsParseError{
+		Line:   p.line,
+		Err:    err,
+		Detail: fmt.Sprintf(format, args...),
 	}
-	p.list = append(p.list, LeapSecond{
-		At:   time.Unix(at-ntpEpochOffset, 0),
-		Leap: int(leap),
-	})
 }
 
-func (p *leapSecondsParser) skipSpace() {
-	if p.err != nil {
-		return
+func (p *leapSecondsParser) parseLine(line string) error {
+	line = strings.TrimRight(line, "\r")
+	if strings.TrimSpace(line) == "" {
+		return nil
 	}
-	for {
-		r, _, err := p.r.ReadRune()
-		if err != nil {
-			p.err = err
-			return
-		}
-		if !unicode.IsSpace(r) {
-			p.err = p.r.UnreadRune()
-			return
+
+	if comment, ok := strings.CutPrefix(line, "#"); ok {
+		switch {
+		case strings.HasPrefix(comment, "$"):
+			// last update date
+			v, err := p.parseDate(comment[1:])
+			if err != nil {
+				return err
+			}
+			p.updateAt = time.Unix(v-ntpEpochOffset, 0)
+			p.update = strconv.AppendInt(p.update[:0], v, 10)
+		case strings.HasPrefix(comment, "@"):
+			// the expiration date
+			v, err := p.parseDate(comment[1:])
+			if err != nil {
+				return err
+			}
+			p.expireAt = time.Unix(v-ntpEpochOffset, 0)
+			p.expire = strconv.AppendInt(p.expire[:0], v, 10)
+		case strings.HasPrefix(comment, "h"):
+			// hash value of the data
+			return p.parseHash(comment[1:])
+		default:
+			// normal comment line, or unknown comment line. ignore it.
 		}
+		return nil
 	}
-}
 
-func (p *leapSecondsParser) skipLine() {
-	if p.err != nil {
-		return
+	// leap second line: NTP timestamp, TAI - UTC, and an optional comment.
+	fields, _, _ := strings.Cut(line, "#")
+	f := strings.Fields(fields)
+	if len(f) != 2 {
+		return p.errorf(ErrLeapSecondsListSyntax, "unexpected line %q", truncate(line, 32))
 	}
-	for {
-		r, _, err := p.r.ReadRune()
-		if err != nil {
-			p.err = err
-			return
+	at, err := p.parseDate(f[0])
+	if err != nil {
+		return err
+	}
+	leap, err := strconv.ParseInt(f[1], 10, 0)
+	if err != nil || leap < 0 || leap > math.MaxInt16 {
+		return p.errorf(ErrLeapSecondsListSyntax, "invalid TAI - UTC %q", truncate(f[1], 32))
+	}
+
+	t := time.Unix(at-ntpEpochOffset, 0)
+	if n := len(p.list); n > 0 {
+		last := p.list[n-1]
+		if !last.At.Before(t) {
+			return p.errorf(ErrLeapSecondsListNotSorted, "%s follows %s at line %d", t.UTC().Format(time.DateOnly), last.At.UTC().Format(time.DateOnly), p.lastLine)
 		}
-		if r == '\n' {
-			break
+		if d := int(leap) - last.Leap; d != 1 && d != -1 {
+			return p.errorf(ErrLeapSecondsListInvalidStep, "from %d to %d", last.Leap, leap)
 		}
 	}
+	p.list = append(p.list, LeapSecond{
+		At:   t,
+		Leap: int(leap),
+	})
+	p.lastLine = p.line
+	p.data = strconv.AppendInt(p.data, at, 10)
+	p.data = strconv.AppendInt(p.data, leap, 10)
+	return nil
 }
 
-func (p *leapSecondsParser) getInt(size int) int64 {
-	p.skipSpace()
-	if p.err != nil {
-		return 0
+// parseDate parses NTP timestamps in seconds.
+func (p *leapSecondsParser) parseDate(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 || v > math.MaxUint32 {
+		return 0, p.errorf(ErrLeapSecondsListSyntax, "invalid NTP timestamp %q", truncate(s, 32))
 	}
-	buf := make([]byte, 0, 20)
-	var err error
-	var r rune
-	for {
-		r, _, err = p.r.ReadRune()
+	return v, nil
+}
+
+// parseHash parses the "#h" line.
+// The hash is five 32-bit words in hexadecimal, e.g. "#h 83c68138 d3650221 07dbbbcd 11fcc859 ced1106a".
+func (p *leapSecondsParser) parseHash(s string) error {
+	words := strings.Fields(s)
+	if len(words) != sha1.Size/4 {
+		return p.errorf(ErrLeapSecondsListSyntax, "invalid hash")
+	}
+	hash := make([]byte, 0, sha1.Size)
+	for _, w := range words {
+		v, err := strconv.ParseUint(w, 16, 32)
 		if err != nil {
-			break
-		}
-		if r < '0' || r > '9' {
-			err = p.r.UnreadRune()
-			break
+			return p.errorf(ErrLeapSecondsListSyntax, "invalid hash")
 		}
-		buf = append(buf, byte(r))
+		hash = binary.BigEndian.AppendUint32(hash, uint32(v))
 	}
-	if len(buf) == 0 && err != nil {
-		p.err = err
-		return 0
+	p.hash = hash
+	return nil
+}
+
+// check checks the whole list.
+func (p *leapSecondsParser) check() error {
+	if len(p.list) < 2 {
+		return &LeapSecondsParseError{Err: ErrLeapSecondsListEmpty}
 	}
+	if p.update == nil {
+		return &LeapSecondsParseError{Err: ErrLeapSecondsListNoUpdate}
+	}
+	if p.expire == nil {
+		return &LeapSecondsParseError{Err: ErrLeapSecondsListNoExpire}
+	}
+	return nil
+}
+
+// verify verifies the hash of the data.
+// The hash is SHA-1 of the digits of the last update date, the expiration date,
+// and the first two columns of the leap second lines.
+func (p *leapSecondsParser) verify() error {
+	h := sha1.New()
+	h.Write(p.update)
+	h.Write(p.expire)
+	h.Write(p.data)
+	got := h.Sum(nil)
+	if p.hash == nil || !bytes.Equal(p.hash, got) {
+		return &LeapSecondsHashError{
+			Want: p.hash,
+			Got:  got,
+		}
+	}
+	return nil
+}
 
-	i, err := strconv.ParseInt(string(buf), 10, size)
-	p.err = err
-	return i
+// truncate truncates s for error messages.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
 }
@@ -2,6 +2,10 @@ package webntp
 
 import (
 	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -20,6 +24,7 @@ func TestTimestamp_MarshalJSON(t *testing.T) {
 		{"1970-01-01T00:00:00.001000Z", "0.001000"},
 		{"1970-01-01T00:00:00.010000Z", "0.010000"},
 		{"1970-01-01T00:00:00.100000Z", "0.100000"},
+		{"1970-01-01T00:00:00.9999995Z", "1.000000"},
 		{"2009-02-14T08:31:30+09:00", "1234567890.000000"},
 	}
 
@@ -96,6 +101,8 @@ func TestParseLeapSecondsList(t *testing.T) {
 # It's test for negative leap second.
 # In fact, the leap second on 1 Jan 1973 is positive
 2303683200	10	# 1 Jan 1973
+
+#h	0c4a8cb8 b1cc440c 8a2955b5 72aa0364 bad08c0f
 `))
 	l, err := ParseLeapSecondsList(r)
 
@@ -135,6 +142,148 @@ func TestParseLeapSecondsList(t *testing.T) {
 	}
 }
 
+func TestParseLeapSecondsList_Hash(t *testing.T) {
+	data, err := os.ReadFile("testdata/leap-seconds-2019-05-02.list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseLeapSecondsList(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]byte{
+		// the leap second on 1 Jan 2017 is removed.
+		"truncated": bytes.Replace(data, []byte("3692217600\t37"), []byte("#"), 1),
+		// the expiration date is extended.
+		"tampered": bytes.Replace(data, []byte("#@\t3786480000"), []byte("#@\t3818016000"), 1),
+		"missing":  bytes.Replace(data, []byte("#h"), []byte("# "), 1),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseLeapSecondsList(bytes.NewReader(data))
+			var herr *LeapSecondsHashError
+			if !errors.As(err, &herr) {
+				t.Fatalf("want LeapSecondsHashError, got %v", err)
+			}
+			if name == "missing" && herr.Want != nil {
+				t.Errorf("want nil, got %x", herr.Want)
+			}
+
+			// lax parsing ignores the hash.
+			if _, err := ParseLeapSecondsListLax(bytes.NewReader(data)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	// malformed hash line
+	malformed := bytes.Replace(data, []byte("#h \t83c68138"), []byte("#h \tzzzzzzzz"), 1)
+	if _, err := ParseLeapSecondsList(bytes.NewReader(malformed)); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestParseLeapSecondsList_Errors(t *testing.T) {
+	const header = "#$ 3676924800\n#@ 3707596800\n"
+	tests := []struct {
+		name  string
+		input string
+		line  int
+		err   error
+	}{
+		{"empty", "", 0, ErrLeapSecondsListEmpty},
+		{"html", "<!DOCTYPE html>\n<html></html>\n", 1, ErrLeapSecondsListSyntax},
+		{"only the definition", header + "2272060800 10\n", 0, ErrLeapSecondsListEmpty},
+		{"missing update", "#@ 3707596800\n2272060800 10\n2287785600 11\n", 0, ErrLeapSecondsListNoUpdate},
+		{"missing expire", "#$ 3676924800\n2272060800 10\n2287785600 11\n", 0, ErrLeapSecondsListNoExpire},
+		{"invalid expire", "#$ 3676924800\n#@ 37075968OO\n", 2, ErrLeapSecondsListSyntax},
+		{"not sorted", header + "2287785600 10\n2272060800 11\n", 4, ErrLeapSecondsListNotSorted},
+		{"duplicated", header + "2272060800 10\n2272060800 11\n", 4, ErrLeapSecondsListNotSorted},
+		{"jump", header + "2272060800 10\n2287785600 12\n", 4, ErrLeapSecondsListInvalidStep},
+		{"decreasing jump", header + "2272060800 10\n2287785600 8\n", 4, ErrLeapSecondsListInvalidStep},
+		{"no change", header + "2272060800 10\n2287785600 10\n", 4, ErrLeapSecondsListInvalidStep},
+		{"missing TAI - UTC", header + "2272060800\n", 3, ErrLeapSecondsListSyntax},
+		{"extra field", header + "2272060800 10 1\n", 3, ErrLeapSecondsListSyntax},
+		{"negative TAI - UTC", header + "2272060800 -10\n", 3, ErrLeapSecondsListSyntax},
+		{"too large", strings.Repeat("#\n", maxLeapSecondsListSize), 0, ErrLeapSecondsListTooLarge},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseLeapSecondsListLax(strings.NewReader(tc.input))
+			var perr *LeapSecondsParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("want LeapSecondsParseError, got %v", err)
+			}
+			if !errors.Is(err, tc.err) {
+				t.Errorf("want %v, got %v", tc.err, err)
+			}
+			if perr.Line != tc.line {
+				t.Errorf("want line %d, got %d (%v)", tc.line, perr.Line, err)
+			}
+		})
+	}
+}
+
+func TestParseLeapSecondsList_LineEndings(t *testing.T) {
+	// CRLF and no newline at the end of file.
+	input := "#$ 3676924800\r\n#@ 3707596800\r\n2272060800\t10\t# 1 Jan 1972\r\n2287785600\t11"
+	l, err := ParseLeapSecondsListLax(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.LeapSeconds) != 1 {
+		t.Fatalf("want 1 leap second, got %d", len(l.LeapSeconds))
+	}
+	if l.LeapSeconds[0].Leap != 10 || l.LeapSeconds[0].Step != 1 {
+		t.Errorf("unexpected leap second: %#v", l.LeapSeconds[0])
+	}
+}
+
+func FuzzParseLeapSecondsList(f *testing.F) {
+	files, err := filepath.Glob("testdata/*.list")
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte("<!DOCTYPE html>"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		l, err := ParseLeapSecondsListLax(bytes.NewReader(data))
+		if err != nil {
+			var perr *LeapSecondsParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("unexpected error type: %T", err)
+			}
+			return
+		}
+		if len(l.LeapSeconds) == 0 {
+			t.Fatal("empty list")
+		}
+		if l.UpdateAt.IsZero() || l.ExpireAt.IsZero() {
+			t.Fatal("missing dates")
+		}
+		for i, leap := range l.LeapSeconds {
+			if leap.Step != 1 && leap.Step != -1 {
+				t.Fatalf("invalid step: %d", leap.Step)
+			}
+			if i > 0 && !l.LeapSeconds[i-1].At.Before(leap.At) {
+				t.Fatal("not sorted")
+			}
+		}
+
+		// the hash verification doesn't change the result.
+		if strict, err := ParseLeapSecondsList(bytes.NewReader(data)); err == nil && len(strict.LeapSeconds) != len(l.LeapSeconds) {
+			t.Fatal("the results differ")
+		}
+	})
+}
+
 func BenchmarkTimestamp_UnmarshalJSON(b *testing.B) {
 	bs := []byte("1234567890.000")
 	for i := 0; i < b.N; i++ {